@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// accountInput what the text input on the account view is being used for
+type accountInput int
+
+const (
+	accountInputNone accountInput = iota
+	accountInputUsername
+	accountInputLinkCode
+)
+
+type accountState struct {
+	username      string
+	keyCount      int
+	linkCode      string
+	linkExpiresAt time.Time
+	input         textinput.Model
+	inputFor      accountInput
+	// message the outcome of the last thing the player tried
+	message string
+}
+
+func openAccount(m model) (model, tea.Cmd) {
+	m.account = accountState{}
+	m = refreshAccount(m)
+	m.activeView = activeViewAccount
+	return m, nil
+}
+
+func refreshAccount(m model) model {
+	if m.guest {
+		return m
+	}
+	username, keyCount, err := fetchIdentity(m.fingerprint)
+	if err != nil {
+		m.data.err = fmt.Errorf("error, when fetchIdentity() for refreshAccount(). Error: %v", err)
+		HandleUnexpectedError(nil, m.data.err)
+		return m
+	}
+	m.account.username = username
+	m.account.keyCount = keyCount
+	m.username = username
+	return m
+}
+
+func startAccountInput(m model, inputFor accountInput) (model, tea.Cmd) {
+	input := textinput.New()
+	switch inputFor {
+	case accountInputUsername:
+		input.Placeholder = "username"
+		input.CharLimit = 20
+	case accountInputLinkCode:
+		input.Placeholder = "code from your other machine"
+		input.CharLimit = linkCodeLength
+	}
+	m.account.input = input
+	m.account.inputFor = inputFor
+	m.account.message = ""
+	return m, m.account.input.Focus()
+}
+
+func updateAccount(m model, msg tea.Msg) (model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.termWidth = msg.Width
+		m.termHeight = msg.Height
+		return m, nil
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC {
+			return m, tea.Quit
+		}
+		if m.account.inputFor != accountInputNone {
+			switch msg.Type {
+			case tea.KeyEsc:
+				m.account.inputFor = accountInputNone
+				return m, nil
+			case tea.KeyEnter:
+				return submitAccountInput(m)
+			}
+			var cmd tea.Cmd
+			m.account.input, cmd = m.account.input.Update(msg)
+			return m, cmd
+		}
+		switch msg.String() {
+		case "esc", "enter":
+			m.activeView = activeViewWelcome
+		case "u":
+			if m.guest {
+				m.account.message = errGuestNotLinkable.Error()
+				return m, nil
+			}
+			return startAccountInput(m, accountInputUsername)
+		case "g":
+			if m.guest {
+				m.account.message = errGuestNotLinkable.Error()
+				return m, nil
+			}
+			code, expiresAt, err := createLinkCode(m.fingerprint)
+			if err != nil {
+				m.data.err = fmt.Errorf("error, when createLinkCode() for updateAccount(). Error: %v", err)
+				HandleUnexpectedError(nil, m.data.err)
+				return m, nil
+			}
+			m.account.linkCode = code
+			m.account.linkExpiresAt = expiresAt
+		case "l":
+			return startAccountInput(m, accountInputLinkCode)
+		case "e":
+			m.preferences.confineErrorsToWord = !m.preferences.confineErrorsToWord
+			return updatePreferences(m), nil
+		case "m":
+			m.preferences.errorMode = cycleValue(errorModes, m.preferences.errorMode, 1)
+			return updatePreferences(m), nil
+		}
+	}
+	return m, nil
+}
+
+// updatePreferences guests keep their preferences for the session
+func updatePreferences(m model) model {
+	if m.guest {
+		return m
+	}
+	err := savePreferences(m.fingerprint, m.preferences)
+	if err != nil {
+		m.data.err = fmt.Errorf("error, when savePreferences() for updatePreferences(). Error: %v", err)
+		HandleUnexpectedError(nil, m.data.err)
+	}
+	return m
+}
+
+// accountErrorMessage errors the player caused are shown as is, anything else is reported
+func accountErrorMessage(err error) string {
+	for _, playerError := range []error{
+		errLinkCodeInvalid,
+		errAlreadyLinked,
+		errUsernameInvalid,
+		errUsernameReserved,
+		errUsernameTaken,
+	} {
+		if errors.Is(err, playerError) {
+			return err.Error()
+		}
+	}
+	HandleUnexpectedError(nil, err)
+	return "something went wrong, try again"
+}
+
+func submitAccountInput(m model) (model, tea.Cmd) {
+	value := m.account.input.Value()
+	switch m.account.inputFor {
+	case accountInputUsername:
+		err := claimUsername(m.fingerprint, value)
+		if err != nil {
+			m.account.message = accountErrorMessage(err)
+			return m, nil
+		}
+		m.account.message = "username claimed"
+	case accountInputLinkCode:
+		identityId, err := redeemLinkCode(value, m.publicKey, m.fingerprint)
+		if err != nil {
+			m.account.message = accountErrorMessage(err)
+			return m, nil
+		}
+		m.fingerprint = identityId
+		m.preferences, err = fetchPreferences(identityId)
+		if err != nil {
+			m.data.err = fmt.Errorf("error, when fetchPreferences() for submitAccountInput(). Error: %v", err)
+			HandleUnexpectedError(nil, m.data.err)
+		}
+		if m.guest {
+			m.username, err = fetchUsername(identityId)
+			if err != nil {
+				m.data.err = fmt.Errorf("error, when fetchUsername() for submitAccountInput(). Error: %v", err)
+				HandleUnexpectedError(nil, m.data.err)
+			}
+			m.account.message = "signed in for this session"
+		} else {
+			m.account.message = "this key is now linked to your account"
+		}
+	}
+	m.account.inputFor = accountInputNone
+	m = refreshAccount(m)
+	return m, nil
+}
+
+func getAccountView(m model) string {
+	b := strings.Builder{}
+	b.WriteString("YOUR ACCOUNT\n\n")
+	if m.guest {
+		b.WriteString("playing as a guest, connect with an ssh key to keep your history\n")
+		b.WriteString("or sign in for this session with a code from a key that is linked\n\n")
+		b.WriteString("L  enter a code\n")
+	} else {
+		username := m.account.username
+		if username == "" {
+			username = "none yet"
+		}
+		b.WriteString(fmt.Sprintf("username:     %s\n", username))
+		b.WriteString(fmt.Sprintf("linked keys:  %d\n\n", m.account.keyCount))
+		b.WriteString("U  claim a username\n")
+		b.WriteString("G  get a code to link another key to this account\n")
+		b.WriteString("L  enter a code from another key, this key's history moves with it\n")
+	}
+	b.WriteString(fmt.Sprintf("\nM  when you press the wrong key: %s\n", m.preferences.errorMode.label()))
+	b.WriteString(fmt.Sprintf("E  confine mistakes to the word they were made in: %s\n", onOff(m.preferences.confineErrorsToWord)))
+	if m.account.linkCode != "" {
+		remaining := time.Until(m.account.linkExpiresAt).Round(time.Minute)
+		if remaining > 0 {
+			b.WriteString(fmt.Sprintf("\nlink code: %s (enter it on your other machine within %s)\n", m.account.linkCode, remaining))
+		}
+	}
+	if m.account.inputFor != accountInputNone {
+		b.WriteString("\n")
+		b.WriteString(m.account.input.View())
+		b.WriteString("\n(ENTER TO SUBMIT, ESC TO CANCEL)")
+	} else {
+		if m.account.message != "" {
+			b.WriteString(fmt.Sprintf("\n%s\n", m.account.message))
+		}
+		b.WriteString("\n(ESC TO GO BACK)")
+	}
+	return b.String()
+}
+
+func onOff(value bool) string {
+	if value {
+		return "on"
+	}
+	return "off"
+}
@@ -1,13 +1,167 @@
 package main
 
-import "time"
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
 
-func startCleanupRoutine() {
-	ticker := time.NewTicker(5 * time.Minute) // Check every 5 mins
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/bubbletea"
+	"github.com/muesli/termenv"
+	"github.com/nats-io/nats.go"
+)
+
+// idleCheckInterval also how late an idle timeout can be noticed
+const idleCheckInterval = 5 * time.Second
+
+const liveSessionContextKey contextKey = "liveSession"
+
+// idleCheckMsg sent to every session by the cleanup routine
+type idleCheckMsg struct {
+	now time.Time
+}
+
+// liveSession what the server holds on to for a connected player, outside of their model
+type liveSession struct {
+	mu             sync.Mutex
+	program        *tea.Program
+	natsConnection *nats.Conn
+	// goodbye printed once the game has closed, set when the server is the one ending the session
+	goodbye string
+}
+
+func (s *liveSession) setProgram(p *tea.Program) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.program = p
+}
+
+// setNatsConnection the connection is closed when the session ends, taking every subscription on it along
+func (s *liveSession) setNatsConnection(nc *nats.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.natsConnection = nc
+}
+
+func (s *liveSession) sayGoodbye(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.goodbye = message
+}
+
+var liveSessions = struct {
+	mu       sync.Mutex
+	sessions map[*liveSession]struct{}
+}{sessions: make(map[*liveSession]struct{})}
+
+// sessionMiddleware keeps track of the session while the game runs and releases what it held once the game closes
+func sessionMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			live := &liveSession{}
+			s.Context().SetValue(liveSessionContextKey, live)
+			liveSessions.mu.Lock()
+			liveSessions.sessions[live] = struct{}{}
+			liveSessions.mu.Unlock()
+
+			next(s)
+
+			liveSessions.mu.Lock()
+			delete(liveSessions.sessions, live)
+			liveSessions.mu.Unlock()
+			live.mu.Lock()
+			defer live.mu.Unlock()
+			if live.natsConnection != nil {
+				live.natsConnection.Close()
+			}
+			if live.goodbye != "" {
+				wish.Println(s, live.goodbye)
+			}
+		}
+	}
+}
+
+// programMiddleware runs the game, the program is handed to the session so the cleanup routine can reach it
+func programMiddleware() wish.Middleware {
+	return bubbletea.MiddlewareWithProgramHandler(func(s ssh.Session) *tea.Program {
+		m, opts := teaHandler(s)
+		p := tea.NewProgram(m, append(opts, bubbletea.MakeOptions(s)...)...)
+		if live, ok := s.Context().Value(liveSessionContextKey).(*liveSession); ok {
+			live.setProgram(p)
+		}
+		return p
+	}, termenv.Ascii)
+}
+
+// startCleanupRoutine asks every session to check whether it has gone idle, each session knows best what idle means for it
+func startCleanupRoutine(ctx context.Context) {
+	ticker := time.NewTicker(idleCheckInterval)
 	go func() {
+		defer ticker.Stop()
 		for {
-			<-ticker.C
-            // todo implement cleanup
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				liveSessions.mu.Lock()
+				for live := range liveSessions.sessions {
+					live.mu.Lock()
+					p := live.program
+					live.mu.Unlock()
+					if p != nil {
+						// Send blocks until the program reads it, which a program that is still starting won't do yet
+						go p.Send(idleCheckMsg{now: now})
+					}
+				}
+				liveSessions.mu.Unlock()
+			}
 		}
 	}()
 }
+
+type idleAction int
+
+const (
+	idleActionNone idleAction = iota
+	idleActionForfeit
+	idleActionDisconnect
+)
+
+// decideIdleAction racers get taken out of a race they stopped typing in, anywhere else the session is closed after
+// a while. Waiting in a lobby never counts as idle.
+func decideIdleAction(m model, s *settings, now time.Time) idleAction {
+	if m.loading {
+		return idleActionNone
+	}
+	idleFor := now.Sub(m.lastInputAt)
+	if m.activeView == activeViewRace {
+		if idleFor >= s.raceIdleTimeout {
+			return idleActionForfeit
+		}
+		return idleActionNone
+	}
+	if idleFor >= s.sessionIdleTimeout {
+		return idleActionDisconnect
+	}
+	return idleActionNone
+}
+
+func handleIdleCheck(m model, now time.Time) (model, tea.Cmd) {
+	s := runtimeSettings()
+	switch decideIdleAction(m, s, now) {
+	case idleActionForfeit:
+		return forfeitRace(m, fmt.Sprintf("you were taken out of the race after %d seconds without typing", int(s.raceIdleTimeout.Seconds())))
+	case idleActionDisconnect:
+		if m.session != nil {
+			m.session.sayGoodbye(fmt.Sprintf(
+				"disconnected after %d minutes without a key pressed, come back any time",
+				int(s.sessionIdleTimeout.Minutes()),
+			))
+		}
+		return m, tea.Quit
+	}
+	return m, nil
+}
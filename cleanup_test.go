@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_decideIdleAction(t *testing.T) {
+	s := &settings{raceIdleTimeout: 30 * time.Second, sessionIdleTimeout: 15 * time.Minute}
+	now := time.Unix(10000, 0)
+	tests := []struct {
+		name string
+		m    model
+		want idleAction
+	}{
+		{
+			name: "racing and typing",
+			m:    model{activeView: activeViewRace, lastInputAt: now.Add(-10 * time.Second)},
+			want: idleActionNone,
+		},
+		{
+			name: "stopped typing during a race",
+			m:    model{activeView: activeViewRace, lastInputAt: now.Add(-30 * time.Second)},
+			want: idleActionForfeit,
+		},
+		{
+			name: "a while on the welcome screen",
+			m:    model{activeView: activeViewWelcome, lastInputAt: now.Add(-5 * time.Minute)},
+			want: idleActionNone,
+		},
+		{
+			name: "too long on the welcome screen",
+			m:    model{activeView: activeViewWelcome, lastInputAt: now.Add(-15 * time.Minute)},
+			want: idleActionDisconnect,
+		},
+		{
+			name: "too long looking at results",
+			m:    model{activeView: activeViewRaceFinished, lastInputAt: now.Add(-20 * time.Minute)},
+			want: idleActionDisconnect,
+		},
+		{
+			name: "waiting in a lobby",
+			m:    model{activeView: activeViewWelcome, loading: true, lastInputAt: now.Add(-20 * time.Minute)},
+			want: idleActionNone,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := decideIdleAction(tt.m, s, now)
+			if got != tt.want {
+				t.Errorf("error, expected %v but got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,577 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/JeremiahVaughan/terminaltype/clients"
+	"github.com/JeremiahVaughan/terminaltype/clients/database"
+	"github.com/JeremiahVaughan/terminaltype/config"
+)
+
+const cliUsage = `usage: terminaltype [-config file] [<command> [flags]]
+
+commands:
+  config check [file]
+  sentences import [-source name] [-kind sentence|quote] [-format txt|jsonl|csv] <file|->
+  sentences export [-source name] [-kind sentence|quote] [-format txt|jsonl|csv]
+  sentences list [-source name] [-kind sentence|quote] [-limit n] [-width n]
+  sentences delete [-source name] [id...]
+  sentences stats
+  replays list [-player name] [-limit n]
+  replays export [-o file] <id>
+
+run without a command to start the server`
+
+const (
+	sentenceFileFormatText  = "txt"
+	sentenceFileFormatJsonl = "jsonl"
+	sentenceFileFormatCsv   = "csv"
+)
+
+// sentenceImportBatchSize keeps each insert well under the number of variables sqlite allows in one statement
+const sentenceImportBatchSize = 500
+
+// sentenceFileEntry one line of a jsonl file or one row of a csv file, the same shape is used for import and export
+// so an export can be imported somewhere else
+type sentenceFileEntry struct {
+	Text   string `json:"text"`
+	Author string `json:"author,omitempty"`
+	Work   string `json:"work,omitempty"`
+	Kind   string `json:"kind,omitempty"`
+	Source string `json:"source,omitempty"`
+}
+
+var sentenceFileCsvHeader = []string{"text", "author", "work", "kind", "source"}
+
+// runCli runs an admin command against the database, the ssh server is not started
+func runCli(c config.Database, args []string, stdout io.Writer) error {
+	if len(args) < 2 || (args[0] != "sentences" && args[0] != "replays") {
+		return fmt.Errorf("error, unknown command %q\n%s", strings.Join(args, " "), cliUsage)
+	}
+	db, err := database.New(c)
+	if err != nil {
+		return fmt.Errorf("error, when creating database client for runCli(). Error: %v", err)
+	}
+	defer db.Conn.Close()
+	theClients = &clients.Clients{Database: db}
+
+	subcommand, flagArgs := args[1], args[2:]
+	if args[0] == "replays" {
+		switch subcommand {
+		case "list":
+			return runReplayList(flagArgs, stdout)
+		case "export":
+			return runReplayExport(flagArgs, stdout)
+		default:
+			return fmt.Errorf("error, unknown replays command %q\n%s", subcommand, cliUsage)
+		}
+	}
+	switch subcommand {
+	case "import":
+		return runSentenceImport(flagArgs, stdout)
+	case "export":
+		return runSentenceExport(flagArgs, stdout)
+	case "list":
+		return runSentenceList(flagArgs, stdout)
+	case "delete":
+		return runSentenceDelete(flagArgs, stdout)
+	case "stats":
+		return runSentenceStats(stdout)
+	default:
+		return fmt.Errorf("error, unknown sentences command %q\n%s", subcommand, cliUsage)
+	}
+}
+
+// runConfigCli the file defaults to the one passed with -config
+func runConfigCli(args []string, configPath string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "check" || len(args) > 2 {
+		return fmt.Errorf("error, unknown command %q\n%s", strings.Join(append([]string{"config"}, args...), " "), cliUsage)
+	}
+	if len(args) == 2 {
+		configPath = args[1]
+	}
+	err := config.Check(configPath)
+	var problems config.ValidationErrors
+	if errors.As(err, &problems) {
+		fmt.Fprintf(stdout, "found %d problems:\n%v\n", len(problems), problems)
+		return errors.New("error, config is invalid")
+	}
+	if err != nil {
+		return fmt.Errorf("error, when config.Check() for runConfigCli(). Error: %v", err)
+	}
+	fmt.Fprintln(stdout, "config ok")
+	return nil
+}
+
+func runSentenceImport(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("sentences import", flag.ContinueOnError)
+	source := flags.String("source", "import", "tags every imported entry that does not name its own source")
+	kind := flags.String("kind", sentenceKindSentence, "sentence or quote, for entries that do not name their own kind")
+	format := flags.String("format", "", "txt (one entry per line), jsonl or csv, worked out from the file extension when left out")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("error, expected exactly one file to import\n%s", cliUsage)
+	}
+	path := flags.Arg(0)
+	if *format == "" {
+		*format = sentenceFileFormatFromPath(path)
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("error, when opening import file for runSentenceImport(). Error: %v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	records, err := parseSentenceFile(r, *format, sentenceFileEntry{Kind: *kind, Source: *source})
+	if err != nil {
+		return fmt.Errorf("error, when parseSentenceFile() for runSentenceImport(). Error: %v", err)
+	}
+	imported, err := importSentenceRecords(records)
+	if err != nil {
+		return fmt.Errorf("error, when importSentenceRecords() for runSentenceImport(). Error: %v", err)
+	}
+	fmt.Fprintf(stdout, "imported %d of %d entries, the rest were junk or already in the pool\n", imported, len(records))
+	return nil
+}
+
+func sentenceFileFormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson":
+		return sentenceFileFormatJsonl
+	case ".csv":
+		return sentenceFileFormatCsv
+	default:
+		return sentenceFileFormatText
+	}
+}
+
+// parseSentenceFile everything goes through filterOutWeirdText the same as generated text does,
+// defaults fills in the kind and source of entries that leave them out
+func parseSentenceFile(r io.Reader, format string, defaults sentenceFileEntry) ([]sentenceRecord, error) {
+	var entries []sentenceFileEntry
+	switch format {
+	case sentenceFileFormatText:
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			entries = append(entries, sentenceFileEntry{Text: scanner.Text()})
+		}
+		err := scanner.Err()
+		if err != nil {
+			return nil, fmt.Errorf("error, when reading text lines. Error: %v", err)
+		}
+	case sentenceFileFormatJsonl:
+		scanner := bufio.NewScanner(r)
+		line := 0
+		for scanner.Scan() {
+			line++
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			var e sentenceFileEntry
+			err := json.Unmarshal(scanner.Bytes(), &e)
+			if err != nil {
+				return nil, fmt.Errorf("error, when decoding jsonl line %d. Error: %v", line, err)
+			}
+			entries = append(entries, e)
+		}
+		err := scanner.Err()
+		if err != nil {
+			return nil, fmt.Errorf("error, when reading jsonl lines. Error: %v", err)
+		}
+	case sentenceFileFormatCsv:
+		rows, err := csv.NewReader(r).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("error, when reading csv. Error: %v", err)
+		}
+		if len(rows) == 0 {
+			return nil, nil
+		}
+		columns := make(map[string]int)
+		for i, name := range rows[0] {
+			columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		if _, ok := columns["text"]; !ok {
+			return nil, errors.New("error, csv header must have a text column")
+		}
+		column := func(row []string, name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(row) {
+				return ""
+			}
+			return row[i]
+		}
+		for _, row := range rows[1:] {
+			entries = append(entries, sentenceFileEntry{
+				Text:   column(row, "text"),
+				Author: column(row, "author"),
+				Work:   column(row, "work"),
+				Kind:   column(row, "kind"),
+				Source: column(row, "source"),
+			})
+		}
+	default:
+		return nil, fmt.Errorf("error, unknown format %q", format)
+	}
+
+	var records []sentenceRecord
+	for _, e := range entries {
+		if strings.TrimSpace(e.Text) == "" {
+			continue
+		}
+		if e.Kind == "" {
+			e.Kind = defaults.Kind
+		}
+		if e.Source == "" {
+			e.Source = defaults.Source
+		}
+		if e.Kind != sentenceKindSentence && e.Kind != sentenceKindQuote {
+			return nil, fmt.Errorf("error, unknown kind %q for %q", e.Kind, e.Text)
+		}
+		text := filterOutWeirdText(e.Text)
+		if e.Kind == sentenceKindSentence {
+			// stored the way generated sentences are, the full stop is put back when sentences are joined into a race
+			text = strings.TrimRight(text, ". ")
+		}
+		records = append(records, sentenceRecord{
+			text:   text,
+			source: e.Source,
+			kind:   e.Kind,
+			author: filterOutWeirdText(e.Author),
+			work:   filterOutWeirdText(e.Work),
+		})
+	}
+	return records, nil
+}
+
+// importSentenceRecords returns how many records made it into the pool
+func importSentenceRecords(records []sentenceRecord) (int64, error) {
+	var imported int64
+	for start := 0; start < len(records); start += sentenceImportBatchSize {
+		end := min(start+sentenceImportBatchSize, len(records))
+		sqlStatement, args := generateSqlForSentenceRecords(records[start:end])
+		if len(args) == 0 {
+			continue
+		}
+		result, err := theClients.Database.Conn.Exec(sqlStatement, args...)
+		if err != nil {
+			return imported, fmt.Errorf("error, when executing sql statement for importSentenceRecords(). Error: %v", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return imported, fmt.Errorf("error, when getting rows affected for importSentenceRecords(). Error: %v", err)
+		}
+		imported += affected
+	}
+	return imported, nil
+}
+
+// sentenceFilter the where clause shared by the commands that take -source and -kind
+func sentenceFilter(source string, kind string) (string, []any) {
+	var conditions []string
+	var args []any
+	if source != "" {
+		conditions = append(conditions, "source = ?")
+		args = append(args, source)
+	}
+	if kind != "" {
+		conditions = append(conditions, "kind = ?")
+		args = append(args, kind)
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func runSentenceExport(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("sentences export", flag.ContinueOnError)
+	source := flags.String("source", "", "only export entries with this source")
+	kind := flags.String("kind", "", "only export entries of this kind")
+	format := flags.String("format", sentenceFileFormatJsonl, "txt, jsonl or csv")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	where, whereArgs := sentenceFilter(*source, *kind)
+	rows, err := theClients.Database.Conn.Query(
+		fmt.Sprintf("SELECT text, author, work, kind, source FROM sentence %s ORDER BY id", where),
+		whereArgs...,
+	)
+	defer closeCliRows(rows)
+	if err != nil {
+		return fmt.Errorf("error, when querying sentences for runSentenceExport(). Error: %v", err)
+	}
+
+	w := bufio.NewWriter(stdout)
+	defer w.Flush()
+	csvWriter := csv.NewWriter(w)
+	jsonEncoder := json.NewEncoder(w)
+	switch *format {
+	case sentenceFileFormatCsv:
+		err = csvWriter.Write(sentenceFileCsvHeader)
+		if err != nil {
+			return fmt.Errorf("error, when writing csv header for runSentenceExport(). Error: %v", err)
+		}
+	case sentenceFileFormatText, sentenceFileFormatJsonl:
+	default:
+		return fmt.Errorf("error, unknown format %q", *format)
+	}
+	for rows.Next() {
+		var e sentenceFileEntry
+		err = rows.Scan(&e.Text, &e.Author, &e.Work, &e.Kind, &e.Source)
+		if err != nil {
+			return fmt.Errorf("error, when scanning sentences for runSentenceExport(). Error: %v", err)
+		}
+		switch *format {
+		case sentenceFileFormatText:
+			_, err = fmt.Fprintln(w, e.Text)
+		case sentenceFileFormatJsonl:
+			err = jsonEncoder.Encode(e)
+		case sentenceFileFormatCsv:
+			err = csvWriter.Write([]string{e.Text, e.Author, e.Work, e.Kind, e.Source})
+		}
+		if err != nil {
+			return fmt.Errorf("error, when writing sentence for runSentenceExport(). Error: %v", err)
+		}
+	}
+	csvWriter.Flush()
+	err = csvWriter.Error()
+	if err != nil {
+		return fmt.Errorf("error, when flushing csv for runSentenceExport(). Error: %v", err)
+	}
+	return rows.Err()
+}
+
+func runSentenceList(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("sentences list", flag.ContinueOnError)
+	source := flags.String("source", "", "only list entries with this source")
+	kind := flags.String("kind", "", "only list entries of this kind")
+	limit := flags.Int("limit", 20, "how many entries to list, newest first")
+	width := flags.Int("width", 60, "longer text is cut to this many characters")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *width < 4 {
+		return fmt.Errorf("error, -width has to be at least 4, got %d", *width)
+	}
+	where, whereArgs := sentenceFilter(*source, *kind)
+	rows, err := theClients.Database.Conn.Query(
+		fmt.Sprintf(
+			"SELECT id, kind, source, difficulty, times_served, text FROM sentence %s ORDER BY id DESC LIMIT ?",
+			where,
+		),
+		append(whereArgs, *limit)...,
+	)
+	defer closeCliRows(rows)
+	if err != nil {
+		return fmt.Errorf("error, when querying sentences for runSentenceList(). Error: %v", err)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "ID\tKIND\tSOURCE\tDIFFICULTY\tSERVED\tTEXT")
+	for rows.Next() {
+		var id int64
+		var k, s, text string
+		var difficulty float64
+		var served int
+		err = rows.Scan(&id, &k, &s, &difficulty, &served, &text)
+		if err != nil {
+			return fmt.Errorf("error, when scanning sentences for runSentenceList(). Error: %v", err)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%.1f\t%d\t%s\n", id, k, s, difficulty, served, truncateText(text, *width))
+	}
+	return rows.Err()
+}
+
+// truncateText cuts by characters rather than bytes so curly quotes and dashes aren't split, width is at least 4
+func truncateText(text string, width int) string {
+	runes := []rune(text)
+	if len(runes) <= width {
+		return text
+	}
+	return string(runes[:width-3]) + "..."
+}
+
+// runSentenceDelete removes sentences by id or by source along with the record of who was served them
+func runSentenceDelete(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("sentences delete", flag.ContinueOnError)
+	source := flags.String("source", "", "delete every entry with this source")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if (*source == "") == (flags.NArg() == 0) {
+		return fmt.Errorf("error, pass either -source or sentence ids but not both\n%s", cliUsage)
+	}
+	where := "WHERE source = ?"
+	whereArgs := []any{*source}
+	if *source == "" {
+		whereArgs = nil
+		for _, a := range flags.Args() {
+			id, err := strconv.ParseInt(a, 10, 64)
+			if err != nil {
+				return fmt.Errorf("error, %q is not a sentence id", a)
+			}
+			whereArgs = append(whereArgs, id)
+		}
+		where = fmt.Sprintf("WHERE id IN (%s)", placeholderList(len(whereArgs)))
+	}
+
+	tx, err := theClients.Database.Conn.Begin()
+	if err != nil {
+		return fmt.Errorf("error, when beginning transaction for runSentenceDelete(). Error: %v", err)
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(
+		fmt.Sprintf("DELETE FROM sentence_served WHERE sentence_id IN (SELECT id FROM sentence %s)", where),
+		whereArgs...,
+	)
+	if err != nil {
+		return fmt.Errorf("error, when deleting served records for runSentenceDelete(). Error: %v", err)
+	}
+	result, err := tx.Exec(fmt.Sprintf("DELETE FROM sentence %s", where), whereArgs...)
+	if err != nil {
+		return fmt.Errorf("error, when deleting sentences for runSentenceDelete(). Error: %v", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error, when getting rows affected for runSentenceDelete(). Error: %v", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error, when committing transaction for runSentenceDelete(). Error: %v", err)
+	}
+	fmt.Fprintf(stdout, "deleted %d entries\n", deleted)
+	return nil
+}
+
+func runSentenceStats(stdout io.Writer) error {
+	rows, err := theClients.Database.Conn.Query(
+		`SELECT kind, source, COUNT(*), AVG(char_count), AVG(difficulty), SUM(times_served)
+FROM sentence
+GROUP BY kind, source
+ORDER BY kind, source`,
+	)
+	defer closeCliRows(rows)
+	if err != nil {
+		return fmt.Errorf("error, when querying sentence stats for runSentenceStats(). Error: %v", err)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "KIND\tSOURCE\tCOUNT\tAVG CHARS\tAVG DIFFICULTY\tTIMES SERVED")
+	for rows.Next() {
+		var kind, source string
+		var count, served int64
+		var avgChars, avgDifficulty float64
+		err = rows.Scan(&kind, &source, &count, &avgChars, &avgDifficulty, &served)
+		if err != nil {
+			return fmt.Errorf("error, when scanning sentence stats for runSentenceStats(). Error: %v", err)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%.0f\t%.1f\t%d\n", kind, source, count, avgChars, avgDifficulty, served)
+	}
+	return rows.Err()
+}
+
+func runReplayList(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("replays list", flag.ContinueOnError)
+	player := flags.String("player", "", "only list races by the player with this username")
+	limit := flags.Int("limit", 20, "how many races to list, newest first")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	where := ""
+	var whereArgs []any
+	if *player != "" {
+		where = "WHERE p.username = ? COLLATE NOCASE"
+		whereArgs = append(whereArgs, *player)
+	}
+	rows, err := theClients.Database.Conn.Query(
+		fmt.Sprintf("SELECT %s\n%s\n%s\nORDER BY r.finished_at DESC, r.id DESC\nLIMIT ?", replaySummaryColumns, replaySummaryJoins, where),
+		append(whereArgs, *limit)...,
+	)
+	defer closeCliRows(rows)
+	if err != nil {
+		return fmt.Errorf("error, when querying replays for runReplayList(). Error: %v", err)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PLAYER\tRACE")
+	for rows.Next() {
+		s, err := scanReplaySummary(rows)
+		if err != nil {
+			return fmt.Errorf("error, when scanning replays for runReplayList(). Error: %v", err)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", s.username, replayLabel(s))
+	}
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("error, when reading replays for runReplayList(). Error: %v", err)
+	}
+	return w.Flush()
+}
+
+// runReplayExport writes the replay as json, to stdout unless -o names a file
+func runReplayExport(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("replays export", flag.ContinueOnError)
+	out := flags.String("o", "", "file to write the replay to")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("error, expected exactly one replay id\n%s", cliUsage)
+	}
+	id, err := strconv.ParseInt(flags.Arg(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("error, replay id %q is not a number", flags.Arg(0))
+	}
+	r, err := fetchReplay(id)
+	if err != nil {
+		return fmt.Errorf("error, when fetchReplay() for runReplayExport(). Error: %v", err)
+	}
+	data, err := encodeReplayFile(r)
+	if err != nil {
+		return fmt.Errorf("error, when encodeReplayFile() for runReplayExport(). Error: %v", err)
+	}
+	data = append(data, '\n')
+	if *out == "" {
+		_, err = stdout.Write(data)
+		return err
+	}
+	err = os.WriteFile(*out, data, 0644)
+	if err != nil {
+		return fmt.Errorf("error, when writing replay file for runReplayExport(). Error: %v", err)
+	}
+	fmt.Fprintf(stdout, "wrote replay %d to %s\n", id, *out)
+	return nil
+}
+
+func closeCliRows(rows *sql.Rows) {
+	if rows != nil {
+		err := rows.Close()
+		if err != nil {
+			log.Printf("error, when attempting to close database rows: %v", err)
+		}
+	}
+}
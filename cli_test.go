@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func Test_parseSentenceFile(t *testing.T) {
+	defaults := sentenceFileEntry{Kind: sentenceKindSentence, Source: "import"}
+	t.Run("text is one entry per line", func(t *testing.T) {
+		got, err := parseSentenceFile(strings.NewReader("The cat sat down.\n\nIt’s late now.\n"), sentenceFileFormatText, defaults)
+		if err != nil {
+			t.Fatalf("error, unexpected error: %v", err)
+		}
+		if len(got) != 2 || got[1].text != "It's late now" || got[1].source != "import" {
+			t.Errorf("error, unexpected records %+v", got)
+		}
+	})
+	t.Run("jsonl entries keep their own kind and source", func(t *testing.T) {
+		input := `{"text":"Be yourself.","author":"Someone","kind":"quote","source":"mine"}` + "\n"
+		got, err := parseSentenceFile(strings.NewReader(input), sentenceFileFormatJsonl, defaults)
+		if err != nil {
+			t.Fatalf("error, unexpected error: %v", err)
+		}
+		if len(got) != 1 || got[0].kind != sentenceKindQuote || got[0].source != "mine" || got[0].author != "Someone" {
+			t.Errorf("error, unexpected records %+v", got)
+		}
+	})
+	t.Run("csv columns are found by the header", func(t *testing.T) {
+		input := "author,text\nSomeone,\"Hello, world.\"\n"
+		got, err := parseSentenceFile(strings.NewReader(input), sentenceFileFormatCsv, defaults)
+		if err != nil {
+			t.Fatalf("error, unexpected error: %v", err)
+		}
+		if len(got) != 1 || got[0].text != "Hello, world" || got[0].author != "Someone" || got[0].kind != sentenceKindSentence {
+			t.Errorf("error, unexpected records %+v", got)
+		}
+	})
+	t.Run("quotes keep their full stop", func(t *testing.T) {
+		got, err := parseSentenceFile(strings.NewReader("Be yourself.\n"), sentenceFileFormatText, sentenceFileEntry{Kind: sentenceKindQuote, Source: "import"})
+		if err != nil {
+			t.Fatalf("error, unexpected error: %v", err)
+		}
+		if len(got) != 1 || got[0].text != "Be yourself." {
+			t.Errorf("error, unexpected records %+v", got)
+		}
+	})
+	t.Run("unknown kinds are rejected", func(t *testing.T) {
+		_, err := parseSentenceFile(strings.NewReader(`{"text":"Hello there.","kind":"poem"}`), sentenceFileFormatJsonl, defaults)
+		if err == nil {
+			t.Errorf("error, expected an error for an unknown kind")
+		}
+	})
+}
+
+func Test_runConfigCli(t *testing.T) {
+	t.Run("every problem is reported with its json path", func(t *testing.T) {
+		path := t.TempDir() + "/config.json"
+		err := os.WriteFile(path, []byte(`{"maxPlayersPerRace": 3, "playerColors": ["#00ff00"], "sshPort": 0}`), 0600)
+		if err != nil {
+			t.Fatalf("error, unexpected error: %v", err)
+		}
+		out := strings.Builder{}
+		err = runConfigCli([]string{"check", path}, "", &out)
+		if err == nil {
+			t.Fatalf("error, expected the config to be invalid")
+		}
+		for _, want := range []string{"maxPlayersPerRace:", "sshPort:", "openaiApiKey:", "hostKey:"} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("error, expected %q in output '%s'", want, out.String())
+			}
+		}
+	})
+}
+
+func Test_truncateText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "short enough", text: "hello", want: "hello"},
+		{name: "exactly the width", text: "“hi” — okay!", want: "“hi” — okay!"},
+		{name: "cut by characters not bytes", text: "“quoted” — said someone", want: "“quoted” ..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateText(tt.text, 12)
+			if got != tt.want {
+				t.Errorf("error, expected %q but got %q", tt.want, got)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("error, expected valid utf-8 but got %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+)
+
+type codeSnippet struct {
+	language string
+	text     string
+}
+
+// codeSnippets real world style source for the code race mode. Indentation is kept as is (tabs for go, spaces for
+// everything else) and lines are kept short enough to fit the race area without wrapping.
+var codeSnippets = []codeSnippet{
+	{
+		language: "go",
+		text: `if err != nil {
+	return fmt.Errorf("error, reading file. Error: %v", err)
+}`,
+	},
+	{
+		language: "go",
+		text: `func sum(values []int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}`,
+	},
+	{
+		language: "go",
+		text: `func handleUser(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+	defer cancel()
+	user, err := store.FindUser(ctx, r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}`,
+	},
+	{
+		language: "go",
+		text: `type Cache struct {
+	mu    sync.RWMutex
+	items map[string]string
+}
+
+func (c *Cache) Get(key string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, ok := c.items[key]
+	return v, ok
+}`,
+	},
+	{
+		language: "python",
+		text: `def fizzbuzz(n):
+    for i in range(1, n + 1):
+        if i % 15 == 0:
+            print("FizzBuzz")
+        elif i % 3 == 0:
+            print("Fizz")
+        elif i % 5 == 0:
+            print("Buzz")
+        else:
+            print(i)`,
+	},
+	{
+		language: "python",
+		text: `with open("data.csv") as f:
+    rows = [line.strip().split(",") for line in f]`,
+	},
+	{
+		language: "python",
+		text: `class Stack:
+    def __init__(self):
+        self.items = []
+
+    def push(self, item):
+        self.items.append(item)
+
+    def pop(self):
+        if not self.items:
+            raise IndexError("pop from empty stack")
+        return self.items.pop()
+
+    def __len__(self):
+        return len(self.items)`,
+	},
+	{
+		language: "shell",
+		text: `for f in *.log; do
+    gzip "$f"
+done`,
+	},
+	{
+		language: "shell",
+		text: `#!/bin/bash
+set -euo pipefail
+
+BACKUP_DIR="/var/backups/$(date +%F)"
+mkdir -p "$BACKUP_DIR"
+tar -czf "$BACKUP_DIR/home.tar.gz" /home
+find /var/backups -mtime +7 -delete
+echo "backup written to $BACKUP_DIR"`,
+	},
+	{
+		language: "shell",
+		text: `git log --since="1 week ago" --pretty=format:"%an" |
+    sort | uniq -c | sort -rn | head -n 5`,
+	},
+	{
+		language: "sql",
+		text: `SELECT name, COUNT(*) AS total
+FROM orders
+GROUP BY name
+ORDER BY total DESC;`,
+	},
+	{
+		language: "sql",
+		text: `CREATE TABLE account (
+    id INTEGER PRIMARY KEY,
+    email TEXT NOT NULL UNIQUE,
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_account_created_at
+ON account (created_at);`,
+	},
+	{
+		language: "sql",
+		text: `WITH monthly AS (
+    SELECT strftime('%Y-%m', created_at) AS month,
+        SUM(amount) AS revenue
+    FROM payment
+    WHERE status = 'settled'
+    GROUP BY month
+)
+SELECT month, revenue,
+    revenue - LAG(revenue) OVER (ORDER BY month) AS change
+FROM monthly
+ORDER BY month DESC
+LIMIT 12;`,
+	},
+}
+
+// pickCodeSnippet picks at random from the few snippets closest in size to the target
+func pickCodeSnippet(snippets []codeSnippet, targetCharCount int) codeSnippet {
+	sorted := make([]codeSnippet, len(snippets))
+	copy(sorted, snippets)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return distance(len(sorted[i].text), targetCharCount) < distance(len(sorted[j].text), targetCharCount)
+	})
+	closest := 3
+	if len(sorted) < closest {
+		closest = len(sorted)
+	}
+	return sorted[rand.Intn(closest)]
+}
+
+func distance(a, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/JeremiahVaughan/terminaltype/models"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+)
+
+const sshCommandUsage = `usage: ssh terminaltype.com [<command> [flags]]
+
+commands:
+  whoami                       who the server thinks you are
+  stats                        your races, best and average words per minute by mode
+  top [--mode name] [--limit n]
+                               each player's fastest race in a mode, sentences unless picked
+  export [--format csv|json]   print your race history
+  export --token               get a token for downloading your race history over http
+  replay list                  your races that can be replayed, newest first
+  replay export <#>            print one of your replays as json
+
+connect without a command to play`
+
+var errGuestHasNoHistory = errors.New("guests don't have a race history, connect with an ssh key to keep one")
+
+// commandUsageError a mistake in how the command was run, shown to the player as is
+type commandUsageError struct {
+	message string
+}
+
+func (e commandUsageError) Error() string {
+	return e.message
+}
+
+// sshCommand prints plain text to out, nothing is read from the player
+type sshCommand func(out io.Writer, identity sessionIdentity, args []string) error
+
+var sshCommands = map[string]sshCommand{
+	"whoami": runWhoamiCommand,
+	"stats":  runStatsCommand,
+	"top":    runTopCommand,
+	"export": runExportCommand,
+	"replay": runReplayCommand,
+}
+
+// commandMiddleware runs `ssh terminaltype.com <command>` instead of the game, it comes before the check for a
+// terminal so commands work from scripts
+func commandMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if len(s.Command()) == 0 {
+				next(s)
+				return
+			}
+			identity, _ := s.Context().Value(identityContextKey).(sessionIdentity)
+			s.Exit(runSshCommand(s, s.Stderr(), identity, s.Command()))
+		}
+	}
+}
+
+// runSshCommand returns the exit status
+func runSshCommand(stdout io.Writer, stderr io.Writer, identity sessionIdentity, args []string) int {
+	command, ok := sshCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n\n%s\n", args[0], sshCommandUsage)
+		return 1
+	}
+	err := command(stdout, identity, args[1:])
+	var usageErr commandUsageError
+	if errors.As(err, &usageErr) {
+		fmt.Fprintln(stderr, usageErr.message)
+		return 1
+	}
+	if err != nil {
+		HandleUnexpectedError(nil, fmt.Errorf("error, when running ssh command %q for runSshCommand(). Error: %v", args[0], err))
+		fmt.Fprintln(stderr, "something went wrong, try again")
+		return 1
+	}
+	return 0
+}
+
+// parseCommandFlags flag errors are the player's mistake, they get the usage along with them
+func parseCommandFlags(flags *flag.FlagSet, args []string) error {
+	flags.SetOutput(io.Discard)
+	err := flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return commandUsageError{message: sshCommandUsage}
+	}
+	if err != nil {
+		return commandUsageError{message: fmt.Sprintf("%v\n\n%s", err, sshCommandUsage)}
+	}
+	if flags.NArg() > 0 {
+		return commandUsageError{message: fmt.Sprintf("unexpected argument %q\n\n%s", flags.Arg(0), sshCommandUsage)}
+	}
+	return nil
+}
+
+func runExportCommand(out io.Writer, identity sessionIdentity, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", models.RaceHistoryFormatCsv, "csv or json")
+	token := flags.Bool("token", false, "print a token for downloading the history over http instead")
+	err := parseCommandFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if *format != models.RaceHistoryFormatCsv && *format != models.RaceHistoryFormatJson {
+		return commandUsageError{message: models.ErrUnknownRaceHistoryFormat.Error()}
+	}
+	if identity.guest {
+		return commandUsageError{message: errGuestHasNoHistory.Error()}
+	}
+	history := models.NewRaceHistoryModel(theClients)
+	if *token {
+		t, err := history.CreateDownloadToken(identity.id)
+		if err != nil {
+			return fmt.Errorf("error, when CreateDownloadToken() for runExportCommand(). Error: %v", err)
+		}
+		fmt.Fprintf(
+			out,
+			"%s\n\ndownload your race history from /export?format=csv on the website with the header "+
+				"\"Authorization: Bearer <token>\". Only if that can't be set, add &token=<token> to the url, "+
+				"urls end up in logs so get a new token afterwards. Getting a new token stops the old one from working.\n",
+			t,
+		)
+		return nil
+	}
+	entries, err := history.Fetch(identity.id)
+	if err != nil {
+		return fmt.Errorf("error, when Fetch() for runExportCommand(). Error: %v", err)
+	}
+	err = history.Write(out, *format, entries)
+	if err != nil {
+		return fmt.Errorf("error, when Write() for runExportCommand(). Error: %v", err)
+	}
+	return nil
+}
+
+func runWhoamiCommand(out io.Writer, identity sessionIdentity, args []string) error {
+	err := parseCommandFlags(flag.NewFlagSet("whoami", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	if identity.guest {
+		_, err = fmt.Fprintln(out, "a guest, connect with an ssh key to keep your history")
+		return err
+	}
+	username, keyCount, err := fetchIdentity(identity.id)
+	if err != nil {
+		return fmt.Errorf("error, when fetchIdentity() for runWhoamiCommand(). Error: %v", err)
+	}
+	if username == "" {
+		username = "no username yet, connect as one to claim it (e.g. ssh alice@terminaltype.com)"
+	}
+	_, err = fmt.Fprintf(out, "%s\nkeys linked: %d\n", username, keyCount)
+	return err
+}
+
+func runStatsCommand(out io.Writer, identity sessionIdentity, args []string) error {
+	err := parseCommandFlags(flag.NewFlagSet("stats", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	if identity.guest {
+		return commandUsageError{message: errGuestHasNoHistory.Error()}
+	}
+	stats, err := fetchModeStats(identity.id)
+	if err != nil {
+		return fmt.Errorf("error, when fetchModeStats() for runStatsCommand(). Error: %v", err)
+	}
+	return writeModeStats(out, stats)
+}
+
+// maxLeaderboardLimit keeps a single command from dumping every player
+const maxLeaderboardLimit = 100
+
+func runTopCommand(out io.Writer, identity sessionIdentity, args []string) error {
+	flags := flag.NewFlagSet("top", flag.ContinueOnError)
+	mode := flags.String("mode", string(raceModeSentences), "which mode's leaderboard to show")
+	limit := flags.Int("limit", 10, "how many players to show")
+	err := parseCommandFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if !contains(raceModes, raceMode(*mode)) {
+		names := make([]string, len(raceModes))
+		for i, m := range raceModes {
+			names[i] = fmt.Sprintf("%q", m)
+		}
+		return commandUsageError{message: fmt.Sprintf("unknown mode %q, pick one of %s", *mode, strings.Join(names, ", "))}
+	}
+	if *limit < 1 || *limit > maxLeaderboardLimit {
+		return commandUsageError{message: fmt.Sprintf("the limit has to be between 1 and %d", maxLeaderboardLimit)}
+	}
+	entries, err := fetchLeaderboard(raceMode(*mode), *limit, runtimeSettings().limits.ExcludeGuestsFromLeaderboards)
+	if err != nil {
+		return fmt.Errorf("error, when fetchLeaderboard() for runTopCommand(). Error: %v", err)
+	}
+	return writeLeaderboard(out, raceMode(*mode), entries)
+}
+
+func runReplayCommand(out io.Writer, identity sessionIdentity, args []string) error {
+	if len(args) == 0 || (args[0] != "list" && args[0] != "export") {
+		return commandUsageError{message: sshCommandUsage}
+	}
+	if identity.guest {
+		return commandUsageError{message: errGuestHasNoHistory.Error()}
+	}
+	if args[0] == "list" {
+		err := parseCommandFlags(flag.NewFlagSet("replay list", flag.ContinueOnError), args[1:])
+		if err != nil {
+			return err
+		}
+		list, err := fetchReplaySummaries(identity.id)
+		if err != nil {
+			return fmt.Errorf("error, when fetchReplaySummaries() for runReplayCommand(). Error: %v", err)
+		}
+		if len(list) == 0 {
+			_, err = fmt.Fprintln(out, "no races yet, connect without a command to play one")
+			return err
+		}
+		for _, s := range list {
+			_, err = fmt.Fprintln(out, replayLabel(s))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(args) != 2 {
+		return commandUsageError{message: fmt.Sprintf("expected exactly one replay #\n\n%s", sshCommandUsage)}
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(args[1], "#"), 10, 64)
+	if err != nil {
+		return commandUsageError{message: fmt.Sprintf("replay %q is not a number, find yours with: replay list", args[1])}
+	}
+	r, err := fetchReplay(id)
+	// someone else's replay gets the same answer as a missing one so ids can't be probed
+	if errors.Is(err, errReplayNotFound) || (err == nil && r.owner != identity.id) {
+		return commandUsageError{message: fmt.Sprintf("you don't have a replay #%d, find yours with: replay list", id)}
+	}
+	if err != nil {
+		return fmt.Errorf("error, when fetchReplay() for runReplayCommand(). Error: %v", err)
+	}
+	data, err := encodeReplayFile(r)
+	if err != nil {
+		return fmt.Errorf("error, when encodeReplayFile() for runReplayCommand(). Error: %v", err)
+	}
+	_, err = out.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_runSshCommand(t *testing.T) {
+	tests := []struct {
+		name       string
+		identity   sessionIdentity
+		args       []string
+		wantStderr string
+	}{
+		{name: "unknown commands list the ones there are", args: []string{"dance"}, wantStderr: "export [--format csv|json]"},
+		{name: "bad flags are the player's mistake", args: []string{"export", "--colour"}, wantStderr: "flag provided but not defined"},
+		{name: "only csv and json can be exported", args: []string{"export", "--format", "xlsx"}, wantStderr: "csv or json"},
+		{name: "guests have no history", identity: sessionIdentity{id: "x", guest: true}, args: []string{"export"}, wantStderr: "guests don't have"},
+		{name: "guests have no stats", identity: sessionIdentity{id: "x", guest: true}, args: []string{"stats"}, wantStderr: "guests don't have"},
+		{name: "top only knows the race modes", args: []string{"top", "--mode", "poems"}, wantStderr: `"custom words"`},
+		{name: "top has a limit", args: []string{"top", "--limit", "1000"}, wantStderr: "between 1 and 100"},
+		{name: "commands don't take arguments", args: []string{"whoami", "me"}, wantStderr: `unexpected argument "me"`},
+		{name: "replay needs list or export", args: []string{"replay"}, wantStderr: "replay export <#>"},
+		{name: "guests have no replays", identity: sessionIdentity{id: "x", guest: true}, args: []string{"replay", "list"}, wantStderr: "guests don't have"},
+		{name: "replay ids are numbers", identity: sessionIdentity{id: "x"}, args: []string{"replay", "export", "last"}, wantStderr: "is not a number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := strings.Builder{}
+			stderr := strings.Builder{}
+			status := runSshCommand(&stdout, &stderr, tt.identity, tt.args)
+			if status != 1 {
+				t.Errorf("error, expected exit status 1 but got %d", status)
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("error, expected stderr to contain %q but got %q", tt.wantStderr, stderr.String())
+			}
+			if stdout.Len() != 0 {
+				t.Errorf("error, expected nothing on stdout but got %q", stdout.String())
+			}
+		})
+	}
+}
+
+func Test_totalModeStats(t *testing.T) {
+	total := totalModeStats([]modeStats{
+		{mode: raceModeWords, races: 3, finished: 2, bestWordsPerMin: 80, totalWordsPerMin: 150, totalAccuracy: 1.9},
+		{mode: raceModeCode, races: 2, finished: 1, bestWordsPerMin: 40, totalWordsPerMin: 40, totalAccuracy: 0.7},
+	})
+	if total.races != 5 || total.finished != 3 || total.bestWordsPerMin != 80 {
+		t.Errorf("error, unexpected totals %+v", total)
+	}
+	if total.averageWordsPerMin() != 63 {
+		t.Errorf("error, expected the average to be weighted by finished races but got %d", total.averageWordsPerMin())
+	}
+	if (modeStats{races: 2}).averageAccuracy() != 0 {
+		t.Errorf("error, expected no accuracy without a finished race")
+	}
+}
+
+func Test_runReplayCommand(t *testing.T) {
+	newTestDatabase(t)
+	owner, err := resolveIdentity(newTestKey(t))
+	if err != nil {
+		t.Fatalf("error, unexpected error: %v", err)
+	}
+	someoneElse, err := resolveIdentity(newTestKey(t))
+	if err != nil {
+		t.Fatalf("error, unexpected error: %v", err)
+	}
+	err = recordRaceResult(owner, raceResult{
+		raceId:       "r",
+		mode:         raceModeWords,
+		errorMode:    errorModeCorrect,
+		wordsPerMin:  60,
+		finishedAt:   time.Now(),
+		text:         "hi",
+		replayEvents: []replayEvent{{At: 100, Key: "h", CorrectPos: 1, IncorrectPos: 1}},
+	})
+	if err != nil {
+		t.Fatalf("error, unexpected error: %v", err)
+	}
+	list, err := fetchReplaySummaries(owner)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("error, expected one replay but got %d (%v)", len(list), err)
+	}
+	id := strconv.FormatInt(list[0].raceResultId, 10)
+
+	t.Run("players can export their own replay", func(t *testing.T) {
+		stdout := strings.Builder{}
+		stderr := strings.Builder{}
+		status := runSshCommand(&stdout, &stderr, sessionIdentity{id: owner}, []string{"replay", "export", "#" + id})
+		if status != 0 {
+			t.Fatalf("error, expected exit status 0 but got %d: %s", status, stderr.String())
+		}
+		var file replayFile
+		err := json.Unmarshal([]byte(stdout.String()), &file)
+		if err != nil {
+			t.Fatalf("error, expected the replay as json but got %q: %v", stdout.String(), err)
+		}
+		if file.Text != "hi" || len(file.Events) != 1 {
+			t.Errorf("error, expected the race's text and keys but got %+v", file)
+		}
+	})
+	t.Run("the list only has the player's own races", func(t *testing.T) {
+		for identity, want := range map[string]string{owner: "#" + id, someoneElse: "no races yet"} {
+			stdout := strings.Builder{}
+			status := runSshCommand(&stdout, &strings.Builder{}, sessionIdentity{id: identity}, []string{"replay", "list"})
+			if status != 0 || !strings.Contains(stdout.String(), want) {
+				t.Errorf("error, expected the list to contain %q but got %q (status %d)", want, stdout.String(), status)
+			}
+		}
+	})
+	t.Run("someone else's replay looks like a missing one", func(t *testing.T) {
+		for _, replayId := range []string{id, "9999"} {
+			stdout := strings.Builder{}
+			stderr := strings.Builder{}
+			status := runSshCommand(&stdout, &stderr, sessionIdentity{id: someoneElse}, []string{"replay", "export", replayId})
+			if status != 1 || !strings.Contains(stderr.String(), "you don't have a replay") {
+				t.Errorf("error, expected replay %s to be refused but got status %d and %q", replayId, status, stderr.String())
+			}
+			if stdout.Len() != 0 {
+				t.Errorf("error, expected nothing on stdout but got %q", stdout.String())
+			}
+		}
+	})
+}
@@ -1,12 +1,16 @@
 package config
 
 import (
+    "os"
     "fmt"
-    "errors"
+    "log"
     "context"
     "encoding/json"
 )
 
+// LongestTimedRaceInSeconds the longest time limit a timed race can be given, RaceTimeoutInSeconds has to outlast it
+const LongestTimedRaceInSeconds = 120
+
 type Config struct {                                           
     LocalMode bool `json:"localMode"`
     OpenAIAPIKey string `json:"openaiApiKey"`
@@ -16,10 +20,20 @@ type Config struct {
     NumberOfSentencesPerTypingTest int `json:"numberOfSentencesPerTypingTest"`                        
     TypingTestDesiredWidth int `json:"typingTestDesiredWidth"`
     RaceStartTimeoutInSeconds int `json:"raceStartTimeoutInSeconds"`
+    // RaceTimeoutInSeconds how long a race can run before whoever hasn't finished is out, long enough for even very slow typers
+    RaceTimeoutInSeconds int `json:"raceTimeoutInSeconds"`
+    // RaceIdleTimeoutInSeconds how long a racer can go without typing before they are taken out of the race
+    RaceIdleTimeoutInSeconds int `json:"raceIdleTimeoutInSeconds"`
+    // SessionIdleTimeoutInMinutes how long a session can sit outside of a race without any keys pressed before it is disconnected
+    SessionIdleTimeoutInMinutes int `json:"sessionIdleTimeoutInMinutes"`
     MaxPlayersPerRace int8 `json:"maxPlayersPerRace"`
+    // PlayerColors one per racer slot so there must be at least MaxPlayersPerRace of them
+    PlayerColors []string `json:"playerColors"`
     HostKey string `json:"hostKey"`
     Database Database `json:"database"`
     Nats Nats `json:"nats"`
+    S3 S3 `json:"s3"`
+    Limits Limits `json:"limits"`
 }                                                              
 
 // config struct for nats
@@ -29,39 +43,149 @@ type Nats struct {
 }
 
 
+// Limits protect the server from any one host or key, all of them can be changed without a restart
+type Limits struct {
+    ConnectionsPerMinutePerIp int `json:"connectionsPerMinutePerIp"`
+    ConnectionsPerMinutePerKey int `json:"connectionsPerMinutePerKey"`
+    // RaceRegistrationsPerMinute applies per ip and per key
+    RaceRegistrationsPerMinute int `json:"raceRegistrationsPerMinute"`
+    MaxSessionsPerIp int `json:"maxSessionsPerIp"`
+    MaxSessionsPerKey int `json:"maxSessionsPerKey"`
+    // ExcludeGuestsFromLeaderboards results from sessions without an ssh key are not recorded
+    ExcludeGuestsFromLeaderboards bool `json:"excludeGuestsFromLeaderboards"`
+}
+
+// S3 where to fetch config from, leave Bucket empty to not use S3
+type S3 struct {
+    Bucket string `json:"bucket"`
+    // Key defaults to <service>/config.json, prefixed with testing/ when not on a production machine
+    Key string `json:"key"`
+}
+
 type Database struct {
     DataDirectory string `json:"dataDirectory"`
     MigrationDirectory string `json:"migrationDirectory"`
 }
 
 
-func New(ctx context.Context) (Config, error) {
-    bytes, err := fetchConfigFromS3(ctx, "terminaltype")
+// New layers config from lowest to highest precedence: defaults, the local file at path (JSON or YAML, skipped when path is empty),
+// the S3 object (only fetched when an S3 bucket is configured by the layers before it) and then TERMINALTYPE_ environment variables
+func New(ctx context.Context, path string) (Config, error) {
+    c, err := load(ctx, path, os.Environ(), fetchConfigFromS3)
+    if err != nil {
+        return Config{}, err
+    }
+    err = c.Validate()
+    if err != nil {
+        return Config{}, fmt.Errorf("error, invalid config. Error: %v", err)
+    }
+    return c, nil
+}
+
+// NewForDatabase layers config the same way as New but only the database section has to be valid
+func NewForDatabase(ctx context.Context, path string) (Config, error) {
+    c, err := load(ctx, path, os.Environ(), fetchConfigFromS3)
+    if err != nil {
+        return Config{}, err
+    }
+    err = c.ValidateDatabase()
+    if err != nil {
+        return Config{}, fmt.Errorf("error, invalid database config. Error: %v", err)
+    }
+    return c, nil
+}
+
+// load every layer New reads, fetchS3 is only called when a bucket is configured
+func load(ctx context.Context, path string, environ []string, fetchS3 func(context.Context, S3) ([]byte, error)) (Config, error) {
+    c, err := loadLocal(path, environ)
     if err != nil {
-        return Config{}, fmt.Errorf("error, when fetching config file. Error: %v", err)
+        return Config{}, err
     }
-    c := Config{}
-    err = json.Unmarshal(bytes, &c)
+    if c.S3.Bucket != "" {
+        bytes, err := fetchS3(ctx, c.S3)
+        if err != nil {
+            return Config{}, fmt.Errorf("error, when fetching config file. Error: %v", err)
+        }
+        err = json.Unmarshal(bytes, &c)
+        if err != nil {
+            return Config{}, fmt.Errorf("error, when unmarshaling config file. Error: %v", err)
+        }
+        // the environment still has the final say
+        err = applyEnvOverrides(&c, environ)
+        if err != nil {
+            return Config{}, fmt.Errorf("error, when applying environment overrides. Error: %v", err)
+        }
+    }
+    return c, nil
+}
+
+// Check validates the config that comes from the defaults, the file at path and the environment without going to S3
+func Check(path string) error {
+    c, err := loadLocal(path, os.Environ())
     if err != nil {
-        return Config{}, fmt.Errorf("error, when unmarshaling config file. Error: %v", err)
+        return err
     }
-    if !c.isValid() {
-        return Config{}, errors.New("error, invalid config, ensure all values are provided")
+    if c.S3.Bucket != "" {
+        log.Printf("skipping s3 bucket %s, only local config is checked", c.S3.Bucket)
+    }
+    return c.Validate()
+}
+
+// loadLocal the defaults, the file at path and the environment layered in that order
+func loadLocal(path string, environ []string) (Config, error) {
+    c := defaults()
+    if path != "" {
+        bytes, err := os.ReadFile(path)
+        if err != nil {
+            return Config{}, fmt.Errorf("error, when reading config file. Error: %v", err)
+        }
+        err = mergeConfigFile(&c, path, bytes)
+        if err != nil {
+            return Config{}, fmt.Errorf("error, when merging config file %s. Error: %v", path, err)
+        }
+    }
+    // the environment may be what configures S3 so it is applied before fetching as well as after
+    err := applyEnvOverrides(&c, environ)
+    if err != nil {
+        return Config{}, fmt.Errorf("error, when applying environment overrides. Error: %v", err)
     }
     return c, nil
 }
 
-func (c *Config) isValid() bool {
-    return c.OpenAIAPIKey != "" &&
-        c.SSHPort != 0 &&
-        c.HTTPPort != 0 &&
-        c.NumberOfSentencesPerTypingTest != 0 &&
-        c.TypingTestDesiredWidth > 5 &&
-        c.HostKey != "" &&
-        c.RaceStartTimeoutInSeconds != 0 && 
-        c.MaxPlayersPerRace != 0 &&
-        c.Database.DataDirectory != "" &&
-        c.Database.MigrationDirectory != "" &&
-        c.Nats.Host != "" &&
-        c.Nats.Port != 0
+func defaults() Config {
+    return Config{
+        SSHPort: 2222,
+        HTTPPort: 8080,
+        UiPath: "ui",
+        NumberOfSentencesPerTypingTest: 3,
+        TypingTestDesiredWidth: 60,
+        RaceStartTimeoutInSeconds: 10,
+        RaceTimeoutInSeconds: 180,
+        RaceIdleTimeoutInSeconds: 30,
+        SessionIdleTimeoutInMinutes: 15,
+        MaxPlayersPerRace: 5,
+        PlayerColors: []string{
+            "#00ff00",
+            "#ff5600",
+            "#0000ff",
+            "#ffff00",
+            "#ff00ff",
+        },
+        Database: Database{
+            DataDirectory: "data",
+            MigrationDirectory: "migrate",
+        },
+        Nats: Nats{
+            Host: "localhost",
+            Port: 4222,
+        },
+        Limits: Limits{
+            ConnectionsPerMinutePerIp: 20,
+            ConnectionsPerMinutePerKey: 10,
+            RaceRegistrationsPerMinute: 20,
+            MaxSessionsPerIp: 10,
+            MaxSessionsPerKey: 3,
+        },
+    }
 }
+
@@ -12,7 +12,9 @@ import (
     "github.com/aws/aws-sdk-go-v2/service/s3"                            
 )
 
-func fetchConfigFromS3(ctx context.Context, serviceName string) ([]byte, error) {                                                     
+const serviceName = "terminaltype"
+
+func fetchConfigFromS3(ctx context.Context, s3Config S3) ([]byte, error) {                                                     
     cfg, err := s3_config.LoadDefaultConfig(ctx) 
     if err != nil {                                                   
        return nil, fmt.Errorf("error, unable to load SDK config, " +        
@@ -21,11 +23,14 @@ func fetchConfigFromS3(ctx context.Context, serviceName string) ([]byte, error)
                                                                          
     svc := s3.NewFromConfig(cfg)                                      
 
-    bucketName := "config-bunker"
-    configFile := fmt.Sprintf("%s/config.json", serviceName)
-    if !isProductionMachine() {
-        log.Println("non-production mode detected, switching to testing configuration")
-        configFile = fmt.Sprintf("testing/%s", configFile)
+    bucketName := s3Config.Bucket
+    configFile := s3Config.Key
+    if configFile == "" {
+        configFile = fmt.Sprintf("%s/config.json", serviceName)
+        if !isProductionMachine() {
+            log.Println("non-production mode detected, switching to testing configuration")
+            configFile = fmt.Sprintf("testing/%s", configFile)
+        }
     }
     objectInput := &s3.GetObjectInput{                                
        Bucket: aws.String(bucketName),                                   
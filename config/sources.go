@@ -0,0 +1,127 @@
+package config
+
+import (
+    "fmt"
+    "path/filepath"
+    "reflect"
+    "strconv"
+    "strings"
+    "unicode"
+    "encoding/json"
+
+    "gopkg.in/yaml.v3"
+)
+
+const envPrefix = "TERMINALTYPE_"
+
+// mergeConfigFile only the values present in the file replace what is already in c. YAML files use the same
+// keys as JSON files.
+func mergeConfigFile(c *Config, path string, bytes []byte) error {
+    switch strings.ToLower(filepath.Ext(path)) {
+    case ".yaml", ".yml":
+        var values map[string]any
+        err := yaml.Unmarshal(bytes, &values)
+        if err != nil {
+            return fmt.Errorf("error, when unmarshaling yaml. Error: %v", err)
+        }
+        // round trip through json so the json tags are the only key names to keep track of
+        bytes, err = json.Marshal(values)
+        if err != nil {
+            return fmt.Errorf("error, when converting yaml to json. Error: %v", err)
+        }
+    }
+    err := json.Unmarshal(bytes, c)
+    if err != nil {
+        return fmt.Errorf("error, when unmarshaling json. Error: %v", err)
+    }
+    return nil
+}
+
+// applyEnvOverrides every field can be set with TERMINALTYPE_ followed by its json path in screaming snake case,
+// e.g. database.dataDirectory is TERMINALTYPE_DATABASE_DATA_DIRECTORY. Lists are comma separated.
+func applyEnvOverrides(c *Config, environ []string) error {
+    env := make(map[string]string)
+    for _, e := range environ {
+        key, value, ok := strings.Cut(e, "=")
+        if ok {
+            env[key] = value
+        }
+    }
+    return applyEnvOverridesToStruct(reflect.ValueOf(c).Elem(), envPrefix, env)
+}
+
+func applyEnvOverridesToStruct(v reflect.Value, prefix string, env map[string]string) error {
+    t := v.Type()
+    for i := 0; i < t.NumField(); i++ {
+        field := t.Field(i)
+        tag := strings.Split(field.Tag.Get("json"), ",")[0]
+        if tag == "" || tag == "-" {
+            continue
+        }
+        name := prefix + toScreamingSnake(tag)
+        fieldValue := v.Field(i)
+        if field.Type.Kind() == reflect.Struct {
+            err := applyEnvOverridesToStruct(fieldValue, name+"_", env)
+            if err != nil {
+                return err
+            }
+            continue
+        }
+        raw, ok := env[name]
+        if !ok {
+            continue
+        }
+        err := setFromString(fieldValue, raw)
+        if err != nil {
+            return fmt.Errorf("error, invalid value for %s. Error: %v", name, err)
+        }
+    }
+    return nil
+}
+
+func setFromString(v reflect.Value, raw string) error {
+    switch v.Kind() {
+    case reflect.String:
+        v.SetString(raw)
+    case reflect.Bool:
+        b, err := strconv.ParseBool(raw)
+        if err != nil {
+            return err
+        }
+        v.SetBool(b)
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+        if err != nil {
+            return err
+        }
+        v.SetInt(n)
+    case reflect.Slice:
+        if v.Type().Elem().Kind() != reflect.String {
+            return fmt.Errorf("unsupported list type %s", v.Type())
+        }
+        var values []string
+        for _, s := range strings.Split(raw, ",") {
+            s = strings.TrimSpace(s)
+            if s != "" {
+                values = append(values, s)
+            }
+        }
+        v.Set(reflect.ValueOf(values))
+    default:
+        return fmt.Errorf("unsupported type %s", v.Type())
+    }
+    return nil
+}
+
+// toScreamingSnake e.g. openaiApiKey becomes OPENAI_API_KEY
+func toScreamingSnake(s string) string {
+    var b strings.Builder
+    runes := []rune(s)
+    for i, r := range runes {
+        if i > 0 && unicode.IsUpper(r) && !unicode.IsUpper(runes[i-1]) {
+            b.WriteRune('_')
+        }
+        b.WriteRune(unicode.ToUpper(r))
+    }
+    return b.String()
+}
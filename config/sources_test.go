@@ -0,0 +1,165 @@
+package config
+
+import (
+    "os"
+    "errors"
+    "encoding/json"
+    "context"
+    "reflect"
+    "strings"
+    "testing"
+    "path/filepath"
+)
+
+func Test_load(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "config.yaml")
+    file := "sshPort: 3000\nhttpPort: 3001\nuiPath: file\nnats:\n  port: 3002\ns3:\n  bucket: configs\n"
+    err := os.WriteFile(path, []byte(file), 0644)
+    if err != nil {
+        t.Fatalf("error, when writing config file: %v", err)
+    }
+    environ := []string{"TERMINALTYPE_HTTP_PORT=4001", "TERMINALTYPE_NATS_PORT=4002", "PATH=/bin"}
+    fetched := false
+    fetchS3 := func(ctx context.Context, s S3) ([]byte, error) {
+        fetched = true
+        if s.Bucket != "configs" {
+            t.Errorf("error, expected the bucket from the file but got %q", s.Bucket)
+        }
+        return []byte(`{"httpPort": 5001, "uiPath": "s3", "nats": {"port": 5002}}`), nil
+    }
+
+    c, err := load(context.Background(), path, environ, fetchS3)
+    if err != nil {
+        t.Fatalf("error, unexpected error: %v", err)
+    }
+    if !fetched {
+        t.Fatalf("error, expected the s3 object to be fetched when a bucket is configured")
+    }
+    tests := []struct {
+        name string
+        got int
+        want int
+    }{
+        {name: "defaults fill what nothing else sets", got: c.TypingTestDesiredWidth, want: 60},
+        {name: "the file replaces defaults", got: c.SSHPort, want: 3000},
+        {name: "the environment beats the file and s3", got: c.HTTPPort, want: 4001},
+        {name: "the environment beats s3 in nested sections", got: c.Nats.Port, want: 4002},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if tt.got != tt.want {
+                t.Errorf("error, expected %d but got %d", tt.want, tt.got)
+            }
+        })
+    }
+    if c.UiPath != "s3" {
+        t.Errorf("error, expected s3 to replace the file's uiPath but got %q", c.UiPath)
+    }
+    if c.Nats.Host != "localhost" {
+        t.Errorf("error, expected the default nats host to survive a partial nats section but got %q", c.Nats.Host)
+    }
+
+    t.Run("s3 is skipped without a bucket", func(t *testing.T) {
+        _, err := load(context.Background(), "", nil, func(ctx context.Context, s S3) ([]byte, error) {
+            return nil, errors.New("should not be called")
+        })
+        if err != nil {
+            t.Errorf("error, unexpected error: %v", err)
+        }
+    })
+    t.Run("the environment can configure s3", func(t *testing.T) {
+        fetched = false
+        _, err := load(context.Background(), "", []string{"TERMINALTYPE_S3_BUCKET=configs"}, fetchS3)
+        if err != nil || !fetched {
+            t.Errorf("error, expected the bucket from the environment to be fetched (%v)", err)
+        }
+    })
+}
+
+func Test_applyEnvOverrides(t *testing.T) {
+    tests := []struct {
+        name string
+        env string
+        want func(c Config) any
+        expected any
+        wantErr string
+    }{
+        {name: "ints", env: "TERMINALTYPE_SSH_PORT=22", want: func(c Config) any { return c.SSHPort }, expected: 22},
+        {name: "small ints", env: "TERMINALTYPE_MAX_PLAYERS_PER_RACE=3", want: func(c Config) any { return c.MaxPlayersPerRace }, expected: int8(3)},
+        {name: "nested fields", env: "TERMINALTYPE_LIMITS_MAX_SESSIONS_PER_IP=7", want: func(c Config) any { return c.Limits.MaxSessionsPerIp }, expected: 7},
+        {name: "bools", env: "TERMINALTYPE_LOCAL_MODE=true", want: func(c Config) any { return c.LocalMode }, expected: true},
+        {name: "abbreviations stay one word", env: "TERMINALTYPE_OPENAI_API_KEY=sk", want: func(c Config) any { return c.OpenAIAPIKey }, expected: "sk"},
+        {
+            name: "lists are comma separated and trimmed",
+            env: "TERMINALTYPE_PLAYER_COLORS=#fff, #000,,",
+            want: func(c Config) any { return c.PlayerColors },
+            expected: []string{"#fff", "#000"},
+        },
+        {name: "an int that isn't one", env: "TERMINALTYPE_SSH_PORT=twenty", wantErr: "TERMINALTYPE_SSH_PORT"},
+        {name: "an int too big for its field", env: "TERMINALTYPE_MAX_PLAYERS_PER_RACE=300", wantErr: "TERMINALTYPE_MAX_PLAYERS_PER_RACE"},
+        {name: "a bool that isn't one", env: "TERMINALTYPE_LOCAL_MODE=yes please", wantErr: "TERMINALTYPE_LOCAL_MODE"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            c := defaults()
+            err := applyEnvOverrides(&c, []string{tt.env})
+            if tt.wantErr != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Errorf("error, expected an error naming %s but got %v", tt.wantErr, err)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("error, unexpected error: %v", err)
+            }
+            if got := tt.want(c); !reflect.DeepEqual(got, tt.expected) {
+                t.Errorf("error, expected %#v but got %#v", tt.expected, got)
+            }
+        })
+    }
+}
+
+func Test_mergeConfigFile(t *testing.T) {
+    for _, tt := range []struct {
+        path string
+        bytes string
+    }{
+        {path: "config.json", bytes: `{"database": {"dataDirectory": "/var/lib/terminaltype"}}`},
+        {path: "config.yml", bytes: "database:\n  dataDirectory: /var/lib/terminaltype\n"},
+    } {
+        t.Run(tt.path, func(t *testing.T) {
+            c := defaults()
+            err := mergeConfigFile(&c, tt.path, []byte(tt.bytes))
+            if err != nil {
+                t.Fatalf("error, unexpected error: %v", err)
+            }
+            if c.Database.DataDirectory != "/var/lib/terminaltype" || c.Database.MigrationDirectory != "migrate" {
+                t.Errorf("error, expected only dataDirectory to change but got %+v", c.Database)
+            }
+        })
+    }
+}
+
+func Test_configExample(t *testing.T) {
+    bytes, err := os.ReadFile("config.example.json")
+    if err != nil {
+        t.Fatalf("error, when reading the example config: %v", err)
+    }
+    // every key in the example has to be one the config reads
+    decoder := json.NewDecoder(strings.NewReader(string(bytes)))
+    decoder.DisallowUnknownFields()
+    var c Config
+    err = decoder.Decode(&c)
+    if err != nil {
+        t.Fatalf("error, expected the example to only use known keys but got %v", err)
+    }
+    c = defaults()
+    err = mergeConfigFile(&c, "config.example.json", bytes)
+    if err != nil {
+        t.Fatalf("error, unexpected error: %v", err)
+    }
+    var problems ValidationErrors
+    if !errors.As(c.Validate(), &problems) || len(problems) != 1 || problems[0].Path != "hostKey" {
+        t.Errorf("error, expected the host key placeholder to be the only blank left to fill in but got %v", problems)
+    }
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+    "encoding/base64"
+)
+
+// ValidationError a problem with a single config value, Path is the JSON path to it
+type ValidationError struct {
+    Path string
+    Reason string
+}
+
+func (e ValidationError) Error() string {
+    return fmt.Sprintf("%s: %s", e.Path, e.Reason)
+}
+
+// ValidationErrors every problem found with a config, not just the first
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+    lines := make([]string, len(e))
+    for i, v := range e {
+        lines[i] = v.Error()
+    }
+    return strings.Join(lines, "\n")
+}
+
+var hexColorRegex = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Validate returns ValidationErrors when anything is wrong, nil otherwise
+func (c *Config) Validate() error {
+    var problems ValidationErrors
+    add := func(path string, reason string, args ...any) {
+        problems = append(problems, ValidationError{Path: path, Reason: fmt.Sprintf(reason, args...)})
+    }
+    required := func(path string, value string) {
+        if strings.TrimSpace(value) == "" {
+            add(path, "is required")
+        }
+    }
+    port := func(path string, value int) {
+        if value < 1 || value > 65535 {
+            add(path, "must be between 1 and 65535, got %d", value)
+        }
+    }
+
+    required("openaiApiKey", c.OpenAIAPIKey)
+    port("sshPort", c.SSHPort)
+    port("httpPort", c.HTTPPort)
+    if c.NumberOfSentencesPerTypingTest < 1 {
+        add("numberOfSentencesPerTypingTest", "must be at least 1, got %d", c.NumberOfSentencesPerTypingTest)
+    }
+    if c.TypingTestDesiredWidth <= 5 {
+        add("typingTestDesiredWidth", "must be more than 5, got %d", c.TypingTestDesiredWidth)
+    }
+    if c.RaceStartTimeoutInSeconds < 1 {
+        add("raceStartTimeoutInSeconds", "must be at least 1, got %d", c.RaceStartTimeoutInSeconds)
+    }
+    if c.RaceTimeoutInSeconds <= LongestTimedRaceInSeconds {
+        add(
+            "raceTimeoutInSeconds",
+            "must be more than %d so the longest timed race ends on its own rather than as a DNF, got %d",
+            LongestTimedRaceInSeconds,
+            c.RaceTimeoutInSeconds,
+        )
+    }
+    if c.RaceIdleTimeoutInSeconds < 1 {
+        add("raceIdleTimeoutInSeconds", "must be at least 1, got %d", c.RaceIdleTimeoutInSeconds)
+    }
+    if c.SessionIdleTimeoutInMinutes < 1 {
+        add("sessionIdleTimeoutInMinutes", "must be at least 1, got %d", c.SessionIdleTimeoutInMinutes)
+    }
+    if c.MaxPlayersPerRace < 1 {
+        add("maxPlayersPerRace", "must be at least 1, got %d", c.MaxPlayersPerRace)
+    } else if int(c.MaxPlayersPerRace) > len(c.PlayerColors) {
+        add(
+            "maxPlayersPerRace",
+            "is %d but there are only %d playerColors, every racer slot needs a color",
+            c.MaxPlayersPerRace,
+            len(c.PlayerColors),
+        )
+    }
+    for i, color := range c.PlayerColors {
+        if !hexColorRegex.MatchString(color) {
+            add(fmt.Sprintf("playerColors[%d]", i), "must be a hex color like #ff00ff, got %q", color)
+        }
+    }
+    if c.HostKey == "" {
+        add("hostKey", "is required")
+    } else if _, err := base64.StdEncoding.DecodeString(c.HostKey); err != nil {
+        add("hostKey", "must be base64 encoded. Error: %v", err)
+    }
+    problems = append(problems, c.Database.validate()...)
+    required("nats.host", c.Nats.Host)
+    port("nats.port", c.Nats.Port)
+    atLeastOne := func(path string, value int) {
+        if value < 1 {
+            add(path, "must be at least 1, got %d", value)
+        }
+    }
+    atLeastOne("limits.connectionsPerMinutePerIp", c.Limits.ConnectionsPerMinutePerIp)
+    atLeastOne("limits.connectionsPerMinutePerKey", c.Limits.ConnectionsPerMinutePerKey)
+    atLeastOne("limits.raceRegistrationsPerMinute", c.Limits.RaceRegistrationsPerMinute)
+    atLeastOne("limits.maxSessionsPerIp", c.Limits.MaxSessionsPerIp)
+    atLeastOne("limits.maxSessionsPerKey", c.Limits.MaxSessionsPerKey)
+    if c.S3.Key != "" && c.S3.Bucket == "" {
+        add("s3.key", "has no effect without s3.bucket")
+    }
+
+    if len(problems) > 0 {
+        return problems
+    }
+    return nil
+}
+
+// ValidateDatabase only checks the database section, which is all the admin commands use
+func (c *Config) ValidateDatabase() error {
+    problems := c.Database.validate()
+    if len(problems) > 0 {
+        return problems
+    }
+    return nil
+}
+
+func (d Database) validate() ValidationErrors {
+    var problems ValidationErrors
+    if strings.TrimSpace(d.DataDirectory) == "" {
+        problems = append(problems, ValidationError{Path: "database.dataDirectory", Reason: "is required"})
+    }
+    if strings.TrimSpace(d.MigrationDirectory) == "" {
+        problems = append(problems, ValidationError{Path: "database.migrationDirectory", Reason: "is required"})
+    }
+    return problems
+}
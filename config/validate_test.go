@@ -0,0 +1,107 @@
+package config
+
+import (
+    "errors"
+    "strings"
+    "testing"
+)
+
+// validConfig the defaults plus the values that have no default
+func validConfig() Config {
+    c := defaults()
+    c.OpenAIAPIKey = "sk-test"
+    c.HostKey = "aG9zdCBrZXk="
+    return c
+}
+
+func Test_Validate(t *testing.T) {
+    tests := []struct {
+        name string
+        change func(c *Config)
+        wantPath string
+        wantReason string
+    }{
+        {name: "openai key", change: func(c *Config) { c.OpenAIAPIKey = " " }, wantPath: "openaiApiKey", wantReason: "is required"},
+        {name: "ssh port", change: func(c *Config) { c.SSHPort = 0 }, wantPath: "sshPort", wantReason: "between 1 and 65535, got 0"},
+        {name: "http port", change: func(c *Config) { c.HTTPPort = 70000 }, wantPath: "httpPort", wantReason: "got 70000"},
+        {name: "sentences", change: func(c *Config) { c.NumberOfSentencesPerTypingTest = 0 }, wantPath: "numberOfSentencesPerTypingTest", wantReason: "at least 1"},
+        {name: "width", change: func(c *Config) { c.TypingTestDesiredWidth = 5 }, wantPath: "typingTestDesiredWidth", wantReason: "more than 5, got 5"},
+        {name: "race start", change: func(c *Config) { c.RaceStartTimeoutInSeconds = 0 }, wantPath: "raceStartTimeoutInSeconds", wantReason: "at least 1"},
+        {name: "race timeout", change: func(c *Config) { c.RaceTimeoutInSeconds = 0 }, wantPath: "raceTimeoutInSeconds", wantReason: "more than 120"},
+        {
+            name: "race timeout no longer than a timed race",
+            change: func(c *Config) { c.RaceTimeoutInSeconds = LongestTimedRaceInSeconds },
+            wantPath: "raceTimeoutInSeconds",
+            wantReason: "longest timed race",
+        },
+        {name: "race idle", change: func(c *Config) { c.RaceIdleTimeoutInSeconds = -1 }, wantPath: "raceIdleTimeoutInSeconds", wantReason: "got -1"},
+        {name: "session idle", change: func(c *Config) { c.SessionIdleTimeoutInMinutes = 0 }, wantPath: "sessionIdleTimeoutInMinutes", wantReason: "at least 1"},
+        {name: "no racers", change: func(c *Config) { c.MaxPlayersPerRace = 0 }, wantPath: "maxPlayersPerRace", wantReason: "at least 1"},
+        {
+            name: "more racers than colors",
+            change: func(c *Config) { c.MaxPlayersPerRace = 6 },
+            wantPath: "maxPlayersPerRace",
+            wantReason: "is 6 but there are only 5 playerColors",
+        },
+        {name: "colors", change: func(c *Config) { c.PlayerColors[2] = "blue" }, wantPath: "playerColors[2]", wantReason: `got "blue"`},
+        {name: "missing host key", change: func(c *Config) { c.HostKey = "" }, wantPath: "hostKey", wantReason: "is required"},
+        {name: "host key encoding", change: func(c *Config) { c.HostKey = "not base64!" }, wantPath: "hostKey", wantReason: "base64"},
+        {name: "data directory", change: func(c *Config) { c.Database.DataDirectory = "" }, wantPath: "database.dataDirectory", wantReason: "is required"},
+        {name: "migrations", change: func(c *Config) { c.Database.MigrationDirectory = "" }, wantPath: "database.migrationDirectory", wantReason: "is required"},
+        {name: "nats host", change: func(c *Config) { c.Nats.Host = "" }, wantPath: "nats.host", wantReason: "is required"},
+        {name: "nats port", change: func(c *Config) { c.Nats.Port = 0 }, wantPath: "nats.port", wantReason: "between 1 and 65535"},
+        {name: "connections per ip", change: func(c *Config) { c.Limits.ConnectionsPerMinutePerIp = 0 }, wantPath: "limits.connectionsPerMinutePerIp", wantReason: "at least 1"},
+        {name: "connections per key", change: func(c *Config) { c.Limits.ConnectionsPerMinutePerKey = 0 }, wantPath: "limits.connectionsPerMinutePerKey", wantReason: "at least 1"},
+        {name: "registrations", change: func(c *Config) { c.Limits.RaceRegistrationsPerMinute = 0 }, wantPath: "limits.raceRegistrationsPerMinute", wantReason: "at least 1"},
+        {name: "sessions per ip", change: func(c *Config) { c.Limits.MaxSessionsPerIp = 0 }, wantPath: "limits.maxSessionsPerIp", wantReason: "at least 1"},
+        {name: "sessions per key", change: func(c *Config) { c.Limits.MaxSessionsPerKey = 0 }, wantPath: "limits.maxSessionsPerKey", wantReason: "at least 1"},
+        {name: "s3 key without a bucket", change: func(c *Config) { c.S3.Key = "a/config.json" }, wantPath: "s3.key", wantReason: "without s3.bucket"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            c := validConfig()
+            tt.change(&c)
+            var problems ValidationErrors
+            err := c.Validate()
+            if !errors.As(err, &problems) || len(problems) != 1 {
+                t.Fatalf("error, expected exactly one problem but got %v", err)
+            }
+            if problems[0].Path != tt.wantPath || !strings.Contains(problems[0].Reason, tt.wantReason) {
+                t.Errorf("error, expected %s to %s but got %v", tt.wantPath, tt.wantReason, problems[0])
+            }
+            if !strings.HasPrefix(err.Error(), tt.wantPath+": ") {
+                t.Errorf("error, expected the message to start with the json path but got %q", err.Error())
+            }
+        })
+    }
+
+    t.Run("valid", func(t *testing.T) {
+        c := validConfig()
+        err := c.Validate()
+        if err != nil {
+            t.Errorf("error, expected no problems but got %v", err)
+        }
+    })
+    t.Run("every problem is reported", func(t *testing.T) {
+        c := validConfig()
+        c.OpenAIAPIKey = ""
+        c.HostKey = ""
+        var problems ValidationErrors
+        if !errors.As(c.Validate(), &problems) || len(problems) != 2 {
+            t.Errorf("error, expected both problems but got %v", problems)
+        }
+    })
+}
+
+func Test_ValidateDatabase(t *testing.T) {
+    c := defaults()
+    err := c.ValidateDatabase()
+    if err != nil {
+        t.Errorf("error, expected the admin commands to not need an openai key or host key but got %v", err)
+    }
+    c.Database.DataDirectory = ""
+    err = c.ValidateDatabase()
+    if err == nil || err.Error() != "database.dataDirectory: is required" {
+        t.Errorf("error, expected the data directory to be required but got %v", err)
+    }
+}
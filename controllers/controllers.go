@@ -10,12 +10,14 @@ type Controllers struct {
     DashBoard *DashBoardController
     TemplateLoader *ui_util.TemplateLoader
     Health *HealthController
+    RaceHistory *RaceHistoryController
 }
 
 func New(views *views.Views, models *models.Models) *Controllers {
     return &Controllers{
         DashBoard: NewDashBoardController(views, models),
         Health: NewHealthController(),
+        RaceHistory: NewRaceHistoryController(models),
         TemplateLoader: views.TemplateLoader,
     }
 }
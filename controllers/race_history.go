@@ -0,0 +1,78 @@
+package controllers
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+
+    "github.com/JeremiahVaughan/terminaltype/models"
+)
+
+type RaceHistoryController struct {
+    history *models.RaceHistoryModel
+    healthy *models.HealthyModel
+}
+
+func NewRaceHistoryController(models *models.Models) *RaceHistoryController {
+    return &RaceHistoryController{
+        history: models.RaceHistory,
+        healthy: models.Healthy,
+    }
+}
+
+// Download the token comes from `ssh terminaltype.com export --token` and belongs in the Authorization header as a
+// bearer token. The token query parameter is only a fallback for spreadsheets that can only be given a url, urls end up
+// in proxy and access logs so the header wins when both are sent.
+func (c *RaceHistoryController) Download(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    token := r.URL.Query().Get("token")
+    if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+        token = strings.TrimPrefix(auth, "Bearer ")
+    }
+    if token == "" {
+        http.Error(w, "a download token is required", http.StatusUnauthorized)
+        return
+    }
+    identityId, err := c.history.IdentityForDownloadToken(token)
+    if err != nil {
+        c.healthy.ReportUnexpectedError(w, fmt.Errorf("error, when IdentityForDownloadToken() for Download(). Error: %v", err))
+        return
+    }
+    if identityId == "" {
+        http.Error(w, "the download token is not valid", http.StatusUnauthorized)
+        return
+    }
+
+    format := r.URL.Query().Get("format")
+    if format == "" {
+        format = models.RaceHistoryFormatCsv
+    }
+    entries, err := c.history.Fetch(identityId)
+    if err != nil {
+        c.healthy.ReportUnexpectedError(w, fmt.Errorf("error, when Fetch() for Download(). Error: %v", err))
+        return
+    }
+    // written to a buffer first so a failure part way through can still be reported with a status code
+    var body bytes.Buffer
+    err = c.history.Write(&body, format, entries)
+    if errors.Is(err, models.ErrUnknownRaceHistoryFormat) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if err != nil {
+        c.healthy.ReportUnexpectedError(w, fmt.Errorf("error, when Write() for Download(). Error: %v", err))
+        return
+    }
+    contentType := "text/csv; charset=utf-8"
+    if format == models.RaceHistoryFormatJson {
+        contentType = "application/json"
+    }
+    w.Header().Set("Content-Type", contentType)
+    w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="race-history.%s"`, format))
+    w.Write(body.Bytes())
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/JeremiahVaughan/terminaltype/clients"
+    "github.com/JeremiahVaughan/terminaltype/clients/database"
+    "github.com/JeremiahVaughan/terminaltype/config"
+    "github.com/JeremiahVaughan/terminaltype/models"
+)
+
+func Test_RaceHistoryController_Download(t *testing.T) {
+    db, err := database.New(config.Database{DataDirectory: t.TempDir(), MigrationDirectory: "../migrate"})
+    if err != nil {
+        t.Fatalf("error, when creating test database: %v", err)
+    }
+    defer db.Conn.Close()
+    history := models.NewRaceHistoryModel(&clients.Clients{Database: db})
+    token, err := history.CreateDownloadToken("me")
+    if err != nil {
+        t.Fatalf("error, unexpected error: %v", err)
+    }
+    c := NewRaceHistoryController(&models.Models{RaceHistory: history})
+
+    tests := []struct {
+        name string
+        url string
+        authorization string
+        wantStatus int
+        wantBody string
+    }{
+        {name: "missing token", url: "/export", wantStatus: http.StatusUnauthorized, wantBody: "token is required"},
+        {name: "bad token", url: "/export", authorization: "Bearer nope", wantStatus: http.StatusUnauthorized, wantBody: "not valid"},
+        {name: "bad token in the url", url: "/export?token=nope", wantStatus: http.StatusUnauthorized, wantBody: "not valid"},
+        {name: "bad format", url: "/export?format=xlsx", authorization: "Bearer " + token, wantStatus: http.StatusBadRequest, wantBody: "csv or json"},
+        {name: "csv by default", url: "/export", authorization: "Bearer " + token, wantStatus: http.StatusOK, wantBody: "finished_at,race_id"},
+        {name: "json", url: "/export?format=json", authorization: "Bearer " + token, wantStatus: http.StatusOK, wantBody: "[]"},
+        {name: "the url token as a fallback", url: "/export?token=" + token, wantStatus: http.StatusOK, wantBody: "finished_at,race_id"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+            if tt.authorization != "" {
+                r.Header.Set("Authorization", tt.authorization)
+            }
+            w := httptest.NewRecorder()
+            c.Download(w, r)
+            if w.Code != tt.wantStatus {
+                t.Errorf("error, expected status %d but got %d", tt.wantStatus, w.Code)
+            }
+            if !strings.Contains(w.Body.String(), tt.wantBody) {
+                t.Errorf("error, expected the body to contain %q but got %q", tt.wantBody, w.Body.String())
+            }
+        })
+    }
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textarea"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func openCustomWordsEditor(m model) (model, tea.Cmd) {
+	words, err := fetchCustomWordList(m.fingerprint)
+	if err != nil {
+		m.data.err = fmt.Errorf("error, when fetchCustomWordList() for openCustomWordsEditor(). Error: %v", err)
+		HandleUnexpectedError(nil, m.data.err)
+		return m, nil
+	}
+	editor := textarea.New()
+	editor.Placeholder = "paste or type the words you want to practice"
+	editor.CharLimit = maxCustomWords * 8
+	editor.MaxHeight = 0
+	editor.SetWidth(m.settings.typingTestDesiredWidth)
+	editor.SetHeight(10)
+	editor.SetValue(strings.Join(words, " "))
+	m.customWordsEditor = editor
+	m.activeView = activeViewCustomWords
+	return m, m.customWordsEditor.Focus()
+}
+
+// updateCustomWordsEditor everything goes to the editor while it is open except for the keys used to leave it
+func updateCustomWordsEditor(m model, msg tea.Msg) (model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.termWidth = msg.Width
+		m.termHeight = msg.Height
+		return m, nil
+	case tea.KeyMsg:
+		switch msg.Type {
+		case tea.KeyCtrlC:
+			return m, tea.Quit
+		case tea.KeyEsc:
+			m.activeView = activeViewWelcome
+			return m, nil
+		case tea.KeyCtrlS:
+			words := parseCustomWordList(m.customWordsEditor.Value())
+			err := saveCustomWordList(m.fingerprint, words)
+			if err != nil {
+				m.data.err = fmt.Errorf("error, when saveCustomWordList() for updateCustomWordsEditor(). Error: %v", err)
+				HandleUnexpectedError(nil, m.data.err)
+			}
+			m.activeView = activeViewWelcome
+			return m, nil
+		}
+	}
+	var cmd tea.Cmd
+	m.customWordsEditor, cmd = m.customWordsEditor.Update(msg)
+	return m, cmd
+}
+
+func getCustomWordsEditorView(m model) string {
+	wordCount := len(parseCustomWordList(m.customWordsEditor.Value()))
+	return fmt.Sprintf(
+		"YOUR CUSTOM WORD LIST (%d/%d words)\n\n%s\n\n(CTRL+S TO SAVE, ESC TO CANCEL)",
+		wordCount,
+		maxCustomWords,
+		m.customWordsEditor.View(),
+	)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// drillChunkChars roughly how many characters each generated chunk of drill text holds
+const drillChunkChars = 120
+
+// maxCustomWords custom word lists are cut off past this many words
+const maxCustomWords = 1000
+
+// maxCustomWordLength longer "words" are dropped from custom word lists
+const maxCustomWordLength = 30
+
+// timedRacePaceWordsPerMin timed races start out with enough text for someone typing this fast,
+// progress bars in timed races are measured against it too
+const timedRacePaceWordsPerMin = 150
+
+var symbolDrillPatterns = []string{
+	"(%s)", "[%s]", "{%s}", "<%s>", `"%s"`, "'%s'",
+	"%s;", "%s:", "%s,", "%s.", "%s!", "%s?",
+	"#%s", "@%s", "%s*", "$%s", "%s%%", "~/%s",
+	"%s-%s", "%s_%s", "%s/%s", "%s=%s", "%s+%s", "%s&%s", "%s|%s", "%s\\%s",
+}
+
+func isDrillMode(mode raceMode) bool {
+	switch mode {
+	case raceModeWords, raceModeCustom, raceModeNumbers, raceModeSymbols, raceModeAdaptive:
+		return true
+	default:
+		return false
+	}
+}
+
+// drillWordList the words a drill mode draws from, custom and weak key lists fall back on the common words when empty
+func drillWordList(mode raceMode, customWords []string) []string {
+	if (mode == raceModeCustom || mode == raceModeAdaptive) && len(customWords) > 0 {
+		return customWords
+	}
+	return commonEnglishWords
+}
+
+// generateDrillText the text a drill race starts out with and how many chunks it took to get there
+func generateDrillText(mode raceMode, wordList []string, seed int64, targetCharCount int) (string, int) {
+	var chunks []string
+	length := 0
+	for length < targetCharCount {
+		chunk := generateDrillChunk(mode, wordList, seed, len(chunks))
+		chunks = append(chunks, chunk)
+		length += len(chunk) + 1
+	}
+	return strings.Join(chunks, " "), len(chunks)
+}
+
+// generateDrillChunk the same mode, word list, seed and chunk index always produce the same text, this is what lets
+// every racer in a timed race extend the text on their own and still be typing the same thing as everybody else
+func generateDrillChunk(mode raceMode, wordList []string, seed int64, chunk int) string {
+	rng := rand.New(rand.NewSource(seed + int64(chunk)))
+	var tokens []string
+	length := 0
+	for length < drillChunkChars {
+		t := drillToken(mode, wordList, rng)
+		tokens = append(tokens, t)
+		length += len(t) + 1
+	}
+	return strings.Join(tokens, " ")
+}
+
+func drillToken(mode raceMode, wordList []string, rng *rand.Rand) string {
+	switch mode {
+	case raceModeNumbers:
+		digits := rng.Intn(6) + 1
+		b := strings.Builder{}
+		for i := 0; i < digits; i++ {
+			b.WriteString(strconv.Itoa(rng.Intn(10)))
+		}
+		return b.String()
+	case raceModeSymbols:
+		pattern := symbolDrillPatterns[rng.Intn(len(symbolDrillPatterns))]
+		switch strings.Count(pattern, "%s") {
+		case 2:
+			return fmt.Sprintf(pattern, wordList[rng.Intn(len(wordList))], wordList[rng.Intn(len(wordList))])
+		default:
+			return fmt.Sprintf(pattern, wordList[rng.Intn(len(wordList))])
+		}
+	default:
+		return wordList[rng.Intn(len(wordList))]
+	}
+}
+
+// extendTimedRaceText timed races keep going until time is up, so the text grows as the player closes in on the end
+func extendTimedRaceText(m model) model {
+	for len(m.raceWordsCharSlice)-m.correctPos < drillChunkChars/2 {
+		chunk := generateDrillChunk(
+			m.data.options.Mode,
+			drillWordList(m.data.options.Mode, m.data.wordList),
+			m.data.seed,
+			m.data.drillChunks,
+		)
+		m.data.drillChunks++
+		m.raceWordsCharSlice = append(m.raceWordsCharSlice, " ")
+		m.raceWordsCharSlice = append(m.raceWordsCharSlice, strings.Split(chunk, "")...)
+	}
+	return m
+}
+
+// timedRacePaceCharCount how much text someone at the pace speed gets through in the time limit
+func timedRacePaceCharCount(timeLimit raceTimeLimit) int {
+	return int(float64(timedRacePaceWordsPerMin*5) * timeLimit.duration().Minutes())
+}
+
+// parseCustomWordList splits whatever the player pasted in into a clean list of words
+func parseCustomWordList(text string) []string {
+	seen := make(map[string]bool)
+	var words []string
+	for _, w := range strings.Fields(filterOutWeirdText(text)) {
+		if len(w) > maxCustomWordLength || seen[w] {
+			continue
+		}
+		seen[w] = true
+		words = append(words, w)
+		if len(words) == maxCustomWords {
+			break
+		}
+	}
+	return words
+}
+
+func fetchCustomWordList(userFingerprint string) ([]string, error) {
+	var result string
+	err := theClients.Database.Conn.QueryRow(
+		`SELECT words
+FROM custom_word_list
+WHERE ssh_finger_print = ?`,
+		userFingerprint,
+	).Scan(
+		&result,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		} else {
+			return nil, fmt.Errorf("error, when attempting to execute sql statement: %v", err)
+		}
+	}
+	return strings.Fields(result), nil
+}
+
+func saveCustomWordList(userFingerprint string, words []string) error {
+	_, err := theClients.Database.Conn.Exec(
+		`INSERT INTO custom_word_list (ssh_finger_print, words, updated_at)
+VALUES (?, ?, ?)
+ON CONFLICT (ssh_finger_print) DO UPDATE
+SET words = excluded.words,
+	updated_at = excluded.updated_at`,
+		userFingerprint,
+		strings.Join(words, " "),
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("error, when executing sql statement for saveCustomWordList(). Error: %v", err)
+	}
+	return nil
+}
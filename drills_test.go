@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/JeremiahVaughan/terminaltype/config"
+)
+
+func Test_generateDrillChunk(t *testing.T) {
+	t.Run("same seed and chunk give the same text", func(t *testing.T) {
+		first := generateDrillChunk(raceModeWords, commonEnglishWords, 42, 3)
+		second := generateDrillChunk(raceModeWords, commonEnglishWords, 42, 3)
+		if first != second {
+			t.Errorf("error, expected '%s' to equal '%s'", first, second)
+		}
+	})
+	t.Run("numbers are only digits", func(t *testing.T) {
+		got := generateDrillChunk(raceModeNumbers, commonEnglishWords, 7, 0)
+		for _, r := range got {
+			if r != ' ' && !unicode.IsDigit(r) {
+				t.Fatalf("error, expected only digits and spaces but got '%s'", got)
+			}
+		}
+	})
+}
+
+func Test_extendTimedRaceText(t *testing.T) {
+	t.Run("text grows as the player nears the end", func(t *testing.T) {
+		text, chunks := generateDrillText(raceModeWords, commonEnglishWords, 1, 10)
+		m := model{
+			raceWordsCharSlice: strings.Split(text, ""),
+			data: modelData{
+				options:     raceOptions{Mode: raceModeWords, TimeLimit: 15},
+				seed:        1,
+				drillChunks: chunks,
+			},
+		}
+		m.correctPos = len(m.raceWordsCharSlice) - 1
+		got := extendTimedRaceText(m)
+		if len(got.raceWordsCharSlice)-got.correctPos < drillChunkChars/2 {
+			t.Errorf("error, expected at least %d characters left to type", drillChunkChars/2)
+		}
+		expected := strings.Join(got.raceWordsCharSlice[:len(text)], "")
+		if text != expected {
+			t.Errorf("error, expected the existing text to be left alone")
+		}
+	})
+}
+
+func Test_parseCustomWordList(t *testing.T) {
+	t.Run("duplicates and overly long words are dropped", func(t *testing.T) {
+		input := "alpha beta\nalpha  gamma " + strings.Repeat("x", maxCustomWordLength+1)
+		expected := "alpha beta gamma"
+		got := strings.Join(parseCustomWordList(input), " ")
+		if got != expected {
+			t.Errorf("error, expected '%s' but got '%s'", expected, got)
+		}
+	})
+}
+
+func Test_raceOptions_lobbyKey(t *testing.T) {
+	for _, mode := range []raceMode{raceModeCustom, raceModeAdaptive} {
+		o := raceOptions{Mode: mode, Length: raceLengthShort}
+		if o.lobbyKey("a") == o.lobbyKey("b") {
+			t.Errorf("error, expected players racing their own %s to get lobbies of their own", mode)
+		}
+	}
+	words := raceOptions{Mode: raceModeWords, Length: raceLengthShort}
+	if words.lobbyKey("a") != words.lobbyKey("b") {
+		t.Errorf("error, expected players picking the same shared options to share a lobby")
+	}
+}
+
+func Test_raceTimeLimits_longest(t *testing.T) {
+	for _, limit := range raceTimeLimits {
+		if limit > config.LongestTimedRaceInSeconds {
+			t.Errorf("error, expected no time limit above config.LongestTimedRaceInSeconds but got %s", limit)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// isWordChar letters, digits and underscores, anything else that isn't whitespace is punctuation like it is in vim
+func isWordChar(char string) bool {
+	r, _ := utf8.DecodeRuneInString(char)
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// previousWordStart where deleting a word back from pos ends up, whitespace right before pos is deleted along with
+// the word. With punctuationAware a run of punctuation is a word of its own (ctrl-w in vim), otherwise only
+// whitespace separates words (alt-backspace).
+func previousWordStart(chars []string, pos int, punctuationAware bool) int {
+	i := pos
+	for i > 0 && isWhitespace(chars[i-1]) {
+		i--
+	}
+	if i == 0 {
+		return 0
+	}
+	wordChar := isWordChar(chars[i-1])
+	for i > 0 && !isWhitespace(chars[i-1]) && (!punctuationAware || isWordChar(chars[i-1]) == wordChar) {
+		i--
+	}
+	return i
+}
+
+// deleteBackTo moves the cursor back to pos, anything typed after it is gone
+func deleteBackTo(m model, pos int) model {
+	if m.correctPos > pos {
+		m.correctPos = pos
+	}
+	m.incorrectPos = pos
+	return forgetMistakesFrom(m, pos)
+}
+
+// forgetMistakesFrom mistakes that have been deleted no longer show, they still count against accuracy
+func forgetMistakesFrom(m model, pos int) model {
+	for p := range m.mistakes {
+		if p >= pos {
+			delete(m.mistakes, p)
+		}
+	}
+	return m
+}
+
+func backspace(m model) model {
+	if m.incorrectPos > m.correctPos {
+		if m.incorrectPos > 0 {
+			m.incorrectPos--
+		}
+	} else {
+		if m.correctPos > 0 {
+			m.correctPos--
+		}
+		if m.incorrectPos > 0 {
+			m.incorrectPos--
+		}
+	}
+	return forgetMistakesFrom(m, m.incorrectPos)
+}
+
+// deleteWord ctrl-w and alt-backspace
+func deleteWord(m model, punctuationAware bool) model {
+	return deleteBackTo(m, previousWordStart(m.raceWordsCharSlice, m.incorrectPos, punctuationAware))
+}
+
+// clearWord ctrl-u, back to the start of the word being worked on, along with any mistakes made after it
+func clearWord(m model) model {
+	i := m.correctPos
+	for i > 0 && !isWhitespace(m.raceWordsCharSlice[i-1]) {
+		i--
+	}
+	return deleteBackTo(m, i)
+}
+
+// errorRunStart where the incorrect run begins when a mistake is made at pos. Normally the whole word containing pos
+// is marked incorrect, confined to the word a mistake on punctuation or a space leaves the word before it alone.
+func errorRunStart(m model, pos int) int {
+	chars := m.raceWordsCharSlice
+	if m.preferences.confineErrorsToWord {
+		if !isWordChar(chars[pos]) {
+			return pos
+		}
+		i := pos
+		for i > 0 && isWordChar(chars[i-1]) {
+			i--
+		}
+		return i
+	}
+	i := pos
+	for i > 0 && !isWhitespace(chars[i-1]) {
+		i--
+	}
+	return i
+}
+
+// canExtendErrorRun whether another wrong key makes the incorrect run longer. Confined to the word the run can't
+// grow past the whitespace after it, a run that started on whitespace doesn't grow at all.
+func canExtendErrorRun(m model) bool {
+	chars := m.raceWordsCharSlice
+	if m.incorrectPos >= len(chars) {
+		return false
+	}
+	if !m.preferences.confineErrorsToWord {
+		return true
+	}
+	end := m.correctPos
+	if isWhitespace(chars[end]) {
+		return m.incorrectPos < end+1
+	}
+	for end < len(chars) && !isWhitespace(chars[end]) {
+		end++
+	}
+	return m.incorrectPos < end
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// typedModel a race over text where the player, with prefs, has typed typed, correct runs and mistakes as they were
+func typedModel(t *testing.T, text string, typed string, prefs preferences) model {
+	t.Helper()
+	m := model{
+		raceWordsCharSlice: strings.Split(text, ""),
+		preferences:        prefs,
+		keyStats:           make(map[keyStatKey]*keyStat),
+	}
+	for _, key := range strings.Split(typed, "") {
+		m, _ = typeKey(m, nil, key)
+	}
+	return m
+}
+
+func Test_evaluateTypedKeyMatch(t *testing.T) {
+	tests := []struct {
+		name             string
+		typed            string
+		confine          bool
+		wantCorrectPos   int
+		wantIncorrectPos int
+	}{
+		{name: "all correct", typed: "hello,", wantCorrectPos: 6, wantIncorrectPos: 6},
+		{name: "a mistake marks the whole word", typed: "hex", wantCorrectPos: 0, wantIncorrectPos: 3},
+		{name: "keys after a mistake grow the run", typed: "hexxxxxxxx", wantCorrectPos: 0, wantIncorrectPos: 10},
+		{name: "a mistake on trailing punctuation marks the word", typed: "hello.", wantCorrectPos: 0, wantIncorrectPos: 6},
+		{name: "a mistake on a space marks the word before it", typed: "hello,x", wantCorrectPos: 0, wantIncorrectPos: 7},
+		{name: "confined, a mistake marks the word", typed: "hex", confine: true, wantCorrectPos: 0, wantIncorrectPos: 3},
+		{name: "confined, the run stops at the end of the word", typed: "hexxxxxxxx", confine: true, wantCorrectPos: 0, wantIncorrectPos: 6},
+		{name: "confined, trailing punctuation is its own word", typed: "hello.", confine: true, wantCorrectPos: 5, wantIncorrectPos: 6},
+		{name: "confined, a mistake on a space leaves the word alone", typed: "hello,xx", confine: true, wantCorrectPos: 6, wantIncorrectPos: 7},
+		{name: "confined, a mistake inside brackets leaves the bracket", typed: "hello, (wx", confine: true, wantCorrectPos: 8, wantIncorrectPos: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := typedModel(t, "hello, (world) again", tt.typed, preferences{confineErrorsToWord: tt.confine})
+			if m.correctPos != tt.wantCorrectPos || m.incorrectPos != tt.wantIncorrectPos {
+				t.Errorf(
+					"error, expected correct %d incorrect %d but got correct %d incorrect %d",
+					tt.wantCorrectPos, tt.wantIncorrectPos, m.correctPos, m.incorrectPos,
+				)
+			}
+		})
+	}
+}
+
+func Test_deleting(t *testing.T) {
+	tests := []struct {
+		name             string
+		typed            string
+		edit             func(model) model
+		wantCorrectPos   int
+		wantIncorrectPos int
+	}{
+		{name: "backspace a correct key", typed: "hel", edit: backspace, wantCorrectPos: 2, wantIncorrectPos: 2},
+		{name: "backspace a mistake", typed: "hex", edit: backspace, wantCorrectPos: 0, wantIncorrectPos: 2},
+		{name: "backspace at the start", typed: "", edit: backspace, wantCorrectPos: 0, wantIncorrectPos: 0},
+		{
+			name:           "ctrl-w stops at punctuation",
+			typed:          "hello, (world",
+			edit:           func(m model) model { return deleteWord(m, true) },
+			wantCorrectPos: 8, wantIncorrectPos: 8,
+		},
+		{
+			name:           "ctrl-w deletes a run of punctuation on its own",
+			typed:          "hello, (",
+			edit:           func(m model) model { return deleteWord(m, true) },
+			wantCorrectPos: 7, wantIncorrectPos: 7,
+		},
+		{
+			name:           "ctrl-w takes the space before the cursor along",
+			typed:          "hello, ",
+			edit:           func(m model) model { return deleteWord(m, true) },
+			wantCorrectPos: 5, wantIncorrectPos: 5,
+		},
+		{
+			name:           "alt-backspace deletes back to whitespace",
+			typed:          "hello, (world",
+			edit:           func(m model) model { return deleteWord(m, false) },
+			wantCorrectPos: 7, wantIncorrectPos: 7,
+		},
+		{
+			name:           "alt-backspace over a mistake",
+			typed:          "hello, (wox",
+			edit:           func(m model) model { return deleteWord(m, false) },
+			wantCorrectPos: 7, wantIncorrectPos: 7,
+		},
+		{name: "ctrl-u clears the word", typed: "hello, (wor", edit: clearWord, wantCorrectPos: 7, wantIncorrectPos: 7},
+		{name: "ctrl-u clears mistakes in the word", typed: "hello, (wxxx", edit: clearWord, wantCorrectPos: 7, wantIncorrectPos: 7},
+		{name: "ctrl-u at the start of a word does nothing", typed: "hello, ", edit: clearWord, wantCorrectPos: 7, wantIncorrectPos: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.edit(typedModel(t, "hello, (world) again", tt.typed, preferences{}))
+			if m.correctPos != tt.wantCorrectPos || m.incorrectPos != tt.wantIncorrectPos {
+				t.Errorf(
+					"error, expected correct %d incorrect %d but got correct %d incorrect %d",
+					tt.wantCorrectPos, tt.wantIncorrectPos, m.correctPos, m.incorrectPos,
+				)
+			}
+		})
+	}
+}
+
+func Test_errorModes(t *testing.T) {
+	tests := []struct {
+		name             string
+		mode             errorMode
+		typed            string
+		wantCorrectPos   int
+		wantIncorrectPos int
+		wantMistakes     []int
+	}{
+		{name: "stop on error rejects the wrong key", mode: errorModeStop, typed: "hexl", wantCorrectPos: 3, wantIncorrectPos: 3},
+		{name: "free flow moves on", mode: errorModeFreeFlow, typed: "hexlo", wantCorrectPos: 5, wantIncorrectPos: 5, wantMistakes: []int{2}},
+		{name: "free flow mistakes on spaces", mode: errorModeFreeFlow, typed: "hello,x(w", wantCorrectPos: 9, wantIncorrectPos: 9, wantMistakes: []int{6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := typedModel(t, "hello, (world) again", tt.typed, preferences{errorMode: tt.mode})
+			if m.correctPos != tt.wantCorrectPos || m.incorrectPos != tt.wantIncorrectPos {
+				t.Errorf(
+					"error, expected correct %d incorrect %d but got correct %d incorrect %d",
+					tt.wantCorrectPos, tt.wantIncorrectPos, m.correctPos, m.incorrectPos,
+				)
+			}
+			if len(m.mistakes) != len(tt.wantMistakes) {
+				t.Fatalf("error, expected mistakes at %v but got %v", tt.wantMistakes, m.mistakes)
+			}
+			for _, p := range tt.wantMistakes {
+				if !m.mistakes[p] {
+					t.Errorf("error, expected a mistake at %d but got %v", p, m.mistakes)
+				}
+			}
+			if accuracy := raceAccuracy(m.keyStats); len(tt.typed) > 0 && accuracy == 1 {
+				t.Errorf("error, expected mistakes to count against accuracy")
+			}
+		})
+	}
+	t.Run("deleting a free flow mistake forgets it", func(t *testing.T) {
+		m := backspace(typedModel(t, "hello", "hex", preferences{errorMode: errorModeFreeFlow}))
+		if m.correctPos != 2 || len(m.mistakes) != 0 {
+			t.Errorf("error, expected to be back at 2 without mistakes but got %d with %v", m.correctPos, m.mistakes)
+		}
+	})
+}
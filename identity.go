@@ -0,0 +1,248 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// linkCodeLifetime how long a player has to enter a link code on their other machine
+const linkCodeLifetime = 10 * time.Minute
+
+// linkCodeAlphabet leaves out characters that are easy to mix up when reading them off another screen
+const linkCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const linkCodeLength = 8
+
+var (
+	errLinkCodeInvalid  = errors.New("that code is wrong or has expired")
+	errAlreadyLinked    = errors.New("this key is already linked to that account")
+	errGuestNotLinkable = errors.New("connect with an ssh key to do that")
+)
+
+// keyFingerprint matches what ssh-keygen -lf prints for the key
+func keyFingerprint(key ssh.PublicKey) string {
+	return gossh.FingerprintSHA256(key)
+}
+
+// legacyKeyFingerprint how players were identified before identities, only used to find history to move over
+func legacyKeyFingerprint(key ssh.PublicKey) string {
+	hash := md5.Sum(key.Marshal())
+	return hex.EncodeToString(hash[:])
+}
+
+// resolveIdentity the identity a key belongs to, one is created the first time a key is seen. The first key of an
+// identity lends it its id. History recorded under the key's legacy fingerprint is moved over at the same time.
+func resolveIdentity(key ssh.PublicKey) (string, error) {
+	fingerprint := keyFingerprint(key)
+	var identityId string
+	err := theClients.Database.Conn.QueryRow(
+		`SELECT identity_id FROM identity_key WHERE key_fingerprint = ?`,
+		fingerprint,
+	).Scan(&identityId)
+	if err == nil {
+		return identityId, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("error, when looking up identity key for resolveIdentity(). Error: %v", err)
+	}
+
+	tx, err := theClients.Database.Conn.Begin()
+	if err != nil {
+		return "", fmt.Errorf("error, when beginning transaction for resolveIdentity(). Error: %v", err)
+	}
+	defer tx.Rollback()
+	now := time.Now().Unix()
+	_, err = tx.Exec(
+		`INSERT INTO identity (id, created_at) VALUES (?, ?) ON CONFLICT (id) DO NOTHING`,
+		fingerprint,
+		now,
+	)
+	if err != nil {
+		return "", fmt.Errorf("error, when inserting identity for resolveIdentity(). Error: %v", err)
+	}
+	_, err = tx.Exec(
+		`INSERT INTO identity_key (key_fingerprint, identity_id, linked_at) VALUES (?, ?, ?)`,
+		fingerprint,
+		fingerprint,
+		now,
+	)
+	if err != nil {
+		return "", fmt.Errorf("error, when inserting identity key for resolveIdentity(). Error: %v", err)
+	}
+	err = mergePlayerHistory(tx, legacyKeyFingerprint(key), fingerprint)
+	if err != nil {
+		return "", fmt.Errorf("error, when mergePlayerHistory() for resolveIdentity(). Error: %v", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return "", fmt.Errorf("error, when committing transaction for resolveIdentity(). Error: %v", err)
+	}
+	return fingerprint, nil
+}
+
+// mergePlayerHistory moves everything recorded for one player id onto another, adding to what is already there.
+// A custom word list and preferences only come along when the destination doesn't have its own.
+func mergePlayerHistory(tx *sql.Tx, from string, to string) error {
+	statements := []string{
+		`INSERT INTO person_who_types (ssh_finger_print, typing_test_completion_count)
+SELECT ?, typing_test_completion_count FROM person_who_types WHERE ssh_finger_print = ?
+ON CONFLICT (ssh_finger_print) DO UPDATE
+SET typing_test_completion_count = typing_test_completion_count + excluded.typing_test_completion_count`,
+		`INSERT INTO sentence_served (ssh_finger_print, sentence_id, served_count, last_served_at)
+SELECT ?, sentence_id, served_count, last_served_at FROM sentence_served WHERE ssh_finger_print = ?
+ON CONFLICT (ssh_finger_print, sentence_id) DO UPDATE
+SET served_count = served_count + excluded.served_count,
+	last_served_at = MAX(last_served_at, excluded.last_served_at)`,
+		`INSERT INTO custom_word_list (ssh_finger_print, words, updated_at)
+SELECT ?, words, updated_at FROM custom_word_list WHERE ssh_finger_print = ?
+ON CONFLICT (ssh_finger_print) DO NOTHING`,
+		`INSERT INTO preference (ssh_finger_print, confine_errors_to_word, error_mode, updated_at)
+SELECT ?, confine_errors_to_word, error_mode, updated_at FROM preference WHERE ssh_finger_print = ?
+ON CONFLICT (ssh_finger_print) DO NOTHING`,
+		`INSERT INTO key_stat (ssh_finger_print, kind, key, attempts, errors, total_latency_ms, latency_samples)
+SELECT ?, kind, key, attempts, errors, total_latency_ms, latency_samples FROM key_stat WHERE ssh_finger_print = ?
+ON CONFLICT (ssh_finger_print, kind, key) DO UPDATE
+SET attempts = attempts + excluded.attempts,
+	errors = errors + excluded.errors,
+	total_latency_ms = total_latency_ms + excluded.total_latency_ms,
+	latency_samples = latency_samples + excluded.latency_samples`,
+		// moved rather than copied so replays stay attached to their results
+		`UPDATE race_result SET ssh_finger_print = ? WHERE ssh_finger_print = ?`,
+	}
+	for _, statement := range statements {
+		_, err := tx.Exec(statement, to, from)
+		if err != nil {
+			return fmt.Errorf("error, when copying player history. Error: %v", err)
+		}
+	}
+	for _, table := range []string{"person_who_types", "sentence_served", "custom_word_list", "key_stat", "preference"} {
+		_, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE ssh_finger_print = ?", table), from)
+		if err != nil {
+			return fmt.Errorf("error, when deleting player history from %s. Error: %v", table, err)
+		}
+	}
+	// a download token only ever works for the identity it was handed to
+	_, err := tx.Exec(`DELETE FROM export_token WHERE identity_id = ?`, from)
+	if err != nil {
+		return fmt.Errorf("error, when deleting download token. Error: %v", err)
+	}
+	return nil
+}
+
+// createLinkCode a single use code that attaches whichever key enters it to identityId
+func createLinkCode(identityId string) (string, time.Time, error) {
+	code := make([]byte, linkCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(linkCodeAlphabet))))
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("error, when generating link code for createLinkCode(). Error: %v", err)
+		}
+		code[i] = linkCodeAlphabet[n.Int64()]
+	}
+	expiresAt := time.Now().Add(linkCodeLifetime)
+	_, err := theClients.Database.Conn.Exec(`DELETE FROM link_code WHERE expires_at < ?`, time.Now().Unix())
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("error, when deleting expired link codes for createLinkCode(). Error: %v", err)
+	}
+	_, err = theClients.Database.Conn.Exec(
+		`INSERT INTO link_code (code, identity_id, expires_at) VALUES (?, ?, ?)`,
+		string(code),
+		identityId,
+		expiresAt.Unix(),
+	)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("error, when inserting link code for createLinkCode(). Error: %v", err)
+	}
+	return string(code), expiresAt, nil
+}
+
+// redeemLinkCode returns the identity the code belongs to. With a key the player's current identity, every key and
+// all history included, is folded into that identity. Without one (guests) the identity is only used for the session.
+func redeemLinkCode(code string, key ssh.PublicKey, currentIdentityId string) (string, error) {
+	tx, err := theClients.Database.Conn.Begin()
+	if err != nil {
+		return "", fmt.Errorf("error, when beginning transaction for redeemLinkCode(). Error: %v", err)
+	}
+	defer tx.Rollback()
+	var targetId string
+	err = tx.QueryRow(
+		`DELETE FROM link_code WHERE code = ? AND expires_at >= ? RETURNING identity_id`,
+		strings.ToUpper(strings.TrimSpace(code)),
+		time.Now().Unix(),
+	).Scan(&targetId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", errLinkCodeInvalid
+	}
+	if err != nil {
+		return "", fmt.Errorf("error, when redeeming link code for redeemLinkCode(). Error: %v", err)
+	}
+	if key != nil {
+		if targetId == currentIdentityId {
+			return "", errAlreadyLinked
+		}
+		_, err = tx.Exec(
+			`UPDATE identity_key SET identity_id = ?, linked_at = ? WHERE identity_id = ?`,
+			targetId,
+			time.Now().Unix(),
+			currentIdentityId,
+		)
+		if err != nil {
+			return "", fmt.Errorf("error, when moving identity keys for redeemLinkCode(). Error: %v", err)
+		}
+		err = mergePlayerHistory(tx, currentIdentityId, targetId)
+		if err != nil {
+			return "", fmt.Errorf("error, when mergePlayerHistory() for redeemLinkCode(). Error: %v", err)
+		}
+		_, err = tx.Exec(`DELETE FROM identity WHERE id = ?`, currentIdentityId)
+		if err != nil {
+			return "", fmt.Errorf("error, when deleting old identity for redeemLinkCode(). Error: %v", err)
+		}
+		// the username comes along when the account being linked to doesn't have one yet, otherwise it is released
+		_, err = tx.Exec(
+			`UPDATE OR IGNORE player SET identity_id = ? WHERE identity_id = ?`,
+			targetId,
+			currentIdentityId,
+		)
+		if err != nil {
+			return "", fmt.Errorf("error, when carrying over username for redeemLinkCode(). Error: %v", err)
+		}
+		_, err = tx.Exec(`DELETE FROM player WHERE identity_id = ?`, currentIdentityId)
+		if err != nil {
+			return "", fmt.Errorf("error, when releasing username for redeemLinkCode(). Error: %v", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return "", fmt.Errorf("error, when committing transaction for redeemLinkCode(). Error: %v", err)
+	}
+	return targetId, nil
+}
+
+// fetchIdentity the username is empty until one is claimed
+func fetchIdentity(identityId string) (string, int, error) {
+	var username sql.NullString
+	var keyCount int
+	err := theClients.Database.Conn.QueryRow(
+		`SELECT p.username, COUNT(k.key_fingerprint)
+FROM identity i
+LEFT JOIN identity_key k ON k.identity_id = i.id
+LEFT JOIN player p ON p.identity_id = i.id
+WHERE i.id = ?
+GROUP BY i.id`,
+		identityId,
+	).Scan(&username, &keyCount)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", 0, fmt.Errorf("error, when querying identity for fetchIdentity(). Error: %v", err)
+	}
+	return username.String, keyCount, nil
+}
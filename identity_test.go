@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/JeremiahVaughan/terminaltype/clients"
+	"github.com/JeremiahVaughan/terminaltype/clients/database"
+	"github.com/JeremiahVaughan/terminaltype/config"
+	"github.com/charmbracelet/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// newTestDatabase a migrated database of its own for the test, theClients points at it until the test ends
+func newTestDatabase(t *testing.T) *database.Client {
+	t.Helper()
+	db, err := database.New(config.Database{DataDirectory: t.TempDir(), MigrationDirectory: "migrate"})
+	if err != nil {
+		t.Fatalf("error, when creating test database: %v", err)
+	}
+	previous := theClients
+	theClients = &clients.Clients{Database: db}
+	t.Cleanup(func() {
+		theClients = previous
+		db.Conn.Close()
+	})
+	return db
+}
+
+func newTestKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("error, when generating key: %v", err)
+	}
+	key, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("error, when converting key: %v", err)
+	}
+	return key
+}
+
+func mustExec(t *testing.T, db *database.Client, query string, args ...any) {
+	t.Helper()
+	_, err := db.Conn.Exec(query, args...)
+	if err != nil {
+		t.Fatalf("error, when running %q: %v", query, err)
+	}
+}
+
+func countRows(t *testing.T, db *database.Client, query string, args ...any) int {
+	t.Helper()
+	var n int
+	err := db.Conn.QueryRow(query, args...).Scan(&n)
+	if err != nil {
+		t.Fatalf("error, when running %q: %v", query, err)
+	}
+	return n
+}
+
+func Test_resolveIdentity(t *testing.T) {
+	db := newTestDatabase(t)
+	key := newTestKey(t)
+	legacy := legacyKeyFingerprint(key)
+	mustExec(t, db, `INSERT INTO person_who_types (ssh_finger_print, typing_test_completion_count) VALUES (?, 3)`, legacy)
+	mustExec(t, db, `INSERT INTO key_stat (ssh_finger_print, kind, key, attempts, errors, total_latency_ms, latency_samples) VALUES (?, 'char', 'a', 10, 2, 1000, 9)`, legacy)
+
+	id, err := resolveIdentity(key)
+	if err != nil {
+		t.Fatalf("error, unexpected error: %v", err)
+	}
+	if id != keyFingerprint(key) {
+		t.Errorf("error, expected the identity to take the sha256 fingerprint %s but got %s", keyFingerprint(key), id)
+	}
+	count, err := fetchCurrentRaceCompletionCount(id)
+	if err != nil || count != 3 {
+		t.Errorf("error, expected the legacy completion count of 3 to move over but got %d (%v)", count, err)
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM key_stat WHERE ssh_finger_print = ?`, id); n != 1 {
+		t.Errorf("error, expected the legacy key stats to move over but found %d", n)
+	}
+	for _, table := range []string{"person_who_types", "key_stat"} {
+		if n := countRows(t, db, "SELECT COUNT(*) FROM "+table+" WHERE ssh_finger_print = ?", legacy); n != 0 {
+			t.Errorf("error, expected nothing left under the legacy fingerprint in %s but found %d", table, n)
+		}
+	}
+
+	again, err := resolveIdentity(key)
+	if err != nil || again != id {
+		t.Errorf("error, expected the same identity on the next connection but got %s (%v)", again, err)
+	}
+	count, _ = fetchCurrentRaceCompletionCount(id)
+	if count != 3 {
+		t.Errorf("error, expected the history to only move once but the count is %d", count)
+	}
+}
+
+func Test_redeemLinkCode(t *testing.T) {
+	t.Run("both sides have history", func(t *testing.T) {
+		db := newTestDatabase(t)
+		targetKey := newTestKey(t)
+		currentKey := newTestKey(t)
+		target, err := resolveIdentity(targetKey)
+		if err != nil {
+			t.Fatalf("error, unexpected error: %v", err)
+		}
+		current, err := resolveIdentity(currentKey)
+		if err != nil {
+			t.Fatalf("error, unexpected error: %v", err)
+		}
+		for fp, count := range map[string]int{target: 2, current: 3} {
+			mustExec(t, db, `INSERT INTO person_who_types (ssh_finger_print, typing_test_completion_count) VALUES (?, ?)`, fp, count)
+			mustExec(t, db, `INSERT INTO key_stat (ssh_finger_print, kind, key, attempts, errors, total_latency_ms, latency_samples) VALUES (?, 'char', 'a', ?, 1, 100, 1)`, fp, count)
+		}
+		err = saveCustomWordList(target, []string{"target"})
+		if err == nil {
+			err = saveCustomWordList(current, []string{"current"})
+		}
+		if err == nil {
+			err = savePreferences(target, preferences{errorMode: errorModeStop})
+		}
+		if err == nil {
+			err = savePreferences(current, preferences{errorMode: errorModeFreeFlow, confineErrorsToWord: true})
+		}
+		if err == nil {
+			err = recordRaceResult(current, raceResult{
+				raceId:       "r",
+				mode:         raceModeWords,
+				errorMode:    errorModeCorrect,
+				wordsPerMin:  60,
+				finishedAt:   time.Now(),
+				text:         "hi",
+				replayEvents: []replayEvent{{At: 100, Key: "h", CorrectPos: 1, IncorrectPos: 1}},
+			})
+		}
+		if err != nil {
+			t.Fatalf("error, unexpected error: %v", err)
+		}
+
+		code, _, err := createLinkCode(target)
+		if err != nil {
+			t.Fatalf("error, unexpected error: %v", err)
+		}
+		linked, err := redeemLinkCode(code, currentKey, current)
+		if err != nil || linked != target {
+			t.Fatalf("error, expected to be linked to %s but got %s (%v)", target, linked, err)
+		}
+
+		count, _ := fetchCurrentRaceCompletionCount(target)
+		if count != 5 {
+			t.Errorf("error, expected the completion counts to be summed to 5 but got %d", count)
+		}
+		stats, _ := fetchKeyStats(target)
+		if s := stats[keyStatKey{kind: keyStatKindChar, key: "a"}]; s == nil || s.attempts != 5 || s.errors != 2 {
+			t.Errorf("error, expected the key stats to be summed but got %+v", s)
+		}
+		words, _ := fetchCustomWordList(target)
+		if len(words) != 1 || words[0] != "target" {
+			t.Errorf("error, expected the target's own custom word list to be kept but got %v", words)
+		}
+		prefs, _ := fetchPreferences(target)
+		if prefs.errorMode != errorModeStop || prefs.confineErrorsToWord {
+			t.Errorf("error, expected the target's own preferences to be kept but got %+v", prefs)
+		}
+		replays, _ := fetchReplaySummaries(target)
+		if len(replays) != 1 {
+			t.Fatalf("error, expected the race result to move over with its replay but found %d", len(replays))
+		}
+		r, err := fetchReplay(replays[0].raceResultId)
+		if err != nil || len(r.events) != 1 {
+			t.Errorf("error, expected the replay to still be attached but got %+v (%v)", r, err)
+		}
+		if id, err := resolveIdentity(currentKey); err != nil || id != target {
+			t.Errorf("error, expected the linked key to resolve to %s but got %s (%v)", target, id, err)
+		}
+		for _, table := range []string{"person_who_types", "key_stat", "custom_word_list", "preference", "race_result"} {
+			if n := countRows(t, db, "SELECT COUNT(*) FROM "+table+" WHERE ssh_finger_print = ?", current); n != 0 {
+				t.Errorf("error, expected nothing left under the old identity in %s but found %d", table, n)
+			}
+		}
+		if n := countRows(t, db, `SELECT COUNT(*) FROM identity WHERE id = ?`, current); n != 0 {
+			t.Errorf("error, expected the old identity to be deleted")
+		}
+	})
+	t.Run("a code only works once", func(t *testing.T) {
+		newTestDatabase(t)
+		target, err := resolveIdentity(newTestKey(t))
+		if err != nil {
+			t.Fatalf("error, unexpected error: %v", err)
+		}
+		code, _, err := createLinkCode(target)
+		if err != nil {
+			t.Fatalf("error, unexpected error: %v", err)
+		}
+		first := newTestKey(t)
+		firstId, _ := resolveIdentity(first)
+		_, err = redeemLinkCode(code, first, firstId)
+		if err != nil {
+			t.Fatalf("error, unexpected error: %v", err)
+		}
+		second := newTestKey(t)
+		secondId, _ := resolveIdentity(second)
+		_, err = redeemLinkCode(code, second, secondId)
+		if !errors.Is(err, errLinkCodeInvalid) {
+			t.Errorf("error, expected a used code to be invalid but got %v", err)
+		}
+	})
+	t.Run("an expired code doesn't work", func(t *testing.T) {
+		db := newTestDatabase(t)
+		target, err := resolveIdentity(newTestKey(t))
+		if err != nil {
+			t.Fatalf("error, unexpected error: %v", err)
+		}
+		mustExec(t, db, `INSERT INTO link_code (code, identity_id, expires_at) VALUES ('ABCDEFGH', ?, ?)`, target, time.Now().Add(-time.Minute).Unix())
+		key := newTestKey(t)
+		id, _ := resolveIdentity(key)
+		_, err = redeemLinkCode("abcdefgh", key, id)
+		if !errors.Is(err, errLinkCodeInvalid) {
+			t.Errorf("error, expected an expired code to be invalid but got %v", err)
+		}
+		if n := countRows(t, db, `SELECT COUNT(*) FROM identity_key WHERE identity_id = ?`, target); n != 1 {
+			t.Errorf("error, expected the key to stay with its own identity")
+		}
+	})
+}
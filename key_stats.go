@@ -0,0 +1,307 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	keyStatKindChar   = "char"
+	keyStatKindBigram = "bigram"
+)
+
+// maxKeyLatency pauses longer than this are the player stopping to think, not a slow key
+const maxKeyLatency = 2 * time.Second
+
+// minKeyStatAttempts keys typed fewer times than this don't have enough data to call them weak
+const minKeyStatAttempts = 5
+
+type keyStatKey struct {
+	kind string
+	key  string
+}
+
+type keyStat struct {
+	attempts           int
+	errors             int
+	totalLatencyMillis int64
+	latencySamples     int
+}
+
+// keyWeakness how a key or bigram ranks against the player's others
+type keyWeakness struct {
+	key                  string
+	errorRate            float64
+	averageLatencyMillis float64
+	score                float64
+}
+
+// recordKeystroke tallies the key the player was meant to type, along with the bigram it finishes
+func recordKeystroke(m model, expected string, typed string, now time.Time) model {
+	if m.keyStats == nil || isWhitespace(expected) && expected != " " {
+		return m
+	}
+	var latency time.Duration
+	if !m.lastKeyAt.IsZero() {
+		latency = now.Sub(m.lastKeyAt)
+	}
+	m.lastKeyAt = now
+	keys := []keyStatKey{{kind: keyStatKindChar, key: expected}}
+	if m.correctPos > 0 {
+		previous := m.raceWordsCharSlice[m.correctPos-1]
+		if !isWhitespace(previous) || previous == " " {
+			keys = append(keys, keyStatKey{kind: keyStatKindBigram, key: previous + expected})
+		}
+	}
+	for _, k := range keys {
+		s, ok := m.keyStats[k]
+		if !ok {
+			s = &keyStat{}
+			m.keyStats[k] = s
+		}
+		s.attempts++
+		if typed != expected {
+			s.errors++
+		} else if latency > 0 && latency < maxKeyLatency {
+			s.totalLatencyMillis += latency.Milliseconds()
+			s.latencySamples++
+		}
+	}
+	return m
+}
+
+func persistKeyStats(userFingerprint string, stats map[keyStatKey]*keyStat) error {
+	if len(stats) == 0 {
+		return nil
+	}
+	var inserts []string
+	var args []any
+	for k, s := range stats {
+		inserts = append(inserts, "(?, ?, ?, ?, ?, ?, ?)")
+		args = append(args, userFingerprint, k.kind, k.key, s.attempts, s.errors, s.totalLatencyMillis, s.latencySamples)
+	}
+	_, err := theClients.Database.Conn.Exec(
+		fmt.Sprintf(
+			`INSERT INTO key_stat (ssh_finger_print, kind, key, attempts, errors, total_latency_ms, latency_samples)
+VALUES %s
+ON CONFLICT (ssh_finger_print, kind, key) DO UPDATE
+SET attempts = attempts + excluded.attempts,
+	errors = errors + excluded.errors,
+	total_latency_ms = total_latency_ms + excluded.total_latency_ms,
+	latency_samples = latency_samples + excluded.latency_samples`,
+			strings.Join(inserts, ","),
+		),
+		args...,
+	)
+	if err != nil {
+		return fmt.Errorf("error, when executing sql statement for persistKeyStats(). Error: %v", err)
+	}
+	return nil
+}
+
+func fetchKeyStats(userFingerprint string) (map[keyStatKey]*keyStat, error) {
+	rows, err := theClients.Database.Conn.Query(
+		`SELECT kind, key, attempts, errors, total_latency_ms, latency_samples
+FROM key_stat
+WHERE ssh_finger_print = ?`,
+		userFingerprint,
+	)
+	defer func(rows *sql.Rows) {
+		if rows != nil {
+			closeRowsError := rows.Close()
+			if closeRowsError != nil {
+				log.Printf("error, when attempting to close database rows: %v", closeRowsError)
+			}
+		}
+	}(rows)
+	if err != nil {
+		return nil, fmt.Errorf("error, when attempting to retrieve key stats. Error: %v", err)
+	}
+	result := make(map[keyStatKey]*keyStat)
+	for rows.Next() {
+		var k keyStatKey
+		var s keyStat
+		err = rows.Scan(&k.kind, &k.key, &s.attempts, &s.errors, &s.totalLatencyMillis, &s.latencySamples)
+		if err != nil {
+			return nil, fmt.Errorf("error, when scanning key stats. Error: %v", err)
+		}
+		result[k] = &s
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error, when iterating through key stats. Error: %v", err)
+	}
+	return result, nil
+}
+
+// rankKeyWeaknesses weakest first. Error rate counts the most, being slower than the player's own average counts too.
+func rankKeyWeaknesses(stats map[keyStatKey]*keyStat, kind string) []keyWeakness {
+	var totalLatency int64
+	var totalSamples int
+	for k, s := range stats {
+		if k.kind == kind {
+			totalLatency += s.totalLatencyMillis
+			totalSamples += s.latencySamples
+		}
+	}
+	overallAverageLatency := 0.0
+	if totalSamples > 0 {
+		overallAverageLatency = float64(totalLatency) / float64(totalSamples)
+	}
+	var result []keyWeakness
+	for k, s := range stats {
+		if k.kind != kind || s.attempts < minKeyStatAttempts {
+			continue
+		}
+		w := keyWeakness{
+			key:       k.key,
+			errorRate: float64(s.errors) / float64(s.attempts),
+		}
+		score := 10 * w.errorRate
+		if s.latencySamples > 0 && overallAverageLatency > 0 {
+			w.averageLatencyMillis = float64(s.totalLatencyMillis) / float64(s.latencySamples)
+			score += math.Max(0, w.averageLatencyMillis/overallAverageLatency-1)
+		}
+		w.score = score
+		result = append(result, w)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].score == result[j].score {
+			return result[i].key < result[j].key
+		}
+		return result[i].score > result[j].score
+	})
+	return result
+}
+
+// buildAdaptiveWordList repeats words in proportion to how many of the player's weak keys and bigrams they contain,
+// picking uniformly from the result then favors the words the player needs to practice
+func buildAdaptiveWordList(words []string, stats map[keyStatKey]*keyStat) []string {
+	weakness := make(map[string]float64)
+	for _, kind := range []string{keyStatKindChar, keyStatKindBigram} {
+		for _, w := range rankKeyWeaknesses(stats, kind) {
+			weakness[w.key] = w.score
+		}
+	}
+	weights := make([]float64, len(words))
+	maxWeight := 0.0
+	for i, word := range words {
+		for j, c := range strings.Split(word, "") {
+			weights[i] += weakness[c]
+			if j > 0 {
+				weights[i] += weakness[word[j-1:j+1]]
+			}
+		}
+		maxWeight = math.Max(maxWeight, weights[i])
+	}
+	var result []string
+	for i, word := range words {
+		copies := 1
+		if maxWeight > 0 {
+			copies += int(math.Round(4 * weights[i] / maxWeight))
+		}
+		for c := 0; c < copies; c++ {
+			result = append(result, word)
+		}
+	}
+	return result
+}
+
+var keyboardRows = []string{
+	"`1234567890-=",
+	"qwertyuiop[]\\",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+}
+
+var heatmapColors = []string{"#2e7d32", "#7cb342", "#fdd835", "#fb8c00", "#c62828"}
+
+// renderKeyboardHeatmap each key is colored by how often the player gets it wrong, keys without enough data are left plain
+func renderKeyboardHeatmap(stats map[keyStatKey]*keyStat) string {
+	errorRates := make(map[string]float64)
+	for _, w := range rankKeyWeaknesses(stats, keyStatKindChar) {
+		errorRates[strings.ToLower(w.key)] = math.Max(errorRates[strings.ToLower(w.key)], w.errorRate)
+	}
+	b := strings.Builder{}
+	for i, row := range keyboardRows {
+		b.WriteString(strings.Repeat(" ", i))
+		for _, r := range row {
+			key := string(r)
+			style := lipgloss.NewStyle().Padding(0, 1)
+			if rate, ok := errorRates[key]; ok {
+				// every 4% error rate is a step hotter
+				bucket := min(len(heatmapColors)-1, int(rate*25))
+				style = style.Foreground(lipgloss.Color("#000000")).Background(lipgloss.Color(heatmapColors[bucket]))
+			}
+			b.WriteString(style.Render(key))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func renderWeakestKeys(title string, weaknesses []keyWeakness, n int) string {
+	b := strings.Builder{}
+	b.WriteString(title)
+	b.WriteString("\n")
+	if len(weaknesses) == 0 {
+		b.WriteString("  not enough races yet\n")
+		return b.String()
+	}
+	for i := 0; i < n && i < len(weaknesses); i++ {
+		w := weaknesses[i]
+		b.WriteString(fmt.Sprintf(
+			"  %-4q %3.0f%% errors  %4.0fms\n",
+			w.key,
+			w.errorRate*100,
+			w.averageLatencyMillis,
+		))
+	}
+	return b.String()
+}
+
+func openProfile(m model) (model, tea.Cmd) {
+	keyStats, err := fetchKeyStats(m.fingerprint)
+	if err != nil {
+		m.data.err = fmt.Errorf("error, when fetchKeyStats() for openProfile(). Error: %v", err)
+		HandleUnexpectedError(nil, m.data.err)
+		return m, nil
+	}
+	m.profileKeyStats = keyStats
+	m.activeView = activeViewProfile
+	return m, nil
+}
+
+func updateProfile(m model, msg tea.Msg) (model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.termWidth = msg.Width
+		m.termHeight = msg.Height
+	case tea.KeyMsg:
+		switch msg.Type {
+		case tea.KeyCtrlC:
+			return m, tea.Quit
+		case tea.KeyEsc, tea.KeyEnter:
+			m.activeView = activeViewWelcome
+		}
+	}
+	return m, nil
+}
+
+func getProfileView(m model) string {
+	return fmt.Sprintf(
+		"YOUR KEYS (greener is better)\n\n%s\n%s\n%s\n(PICK \"%s\" MODE TO PRACTICE THEM, ESC TO GO BACK)",
+		renderKeyboardHeatmap(m.profileKeyStats),
+		renderWeakestKeys("weakest keys", rankKeyWeaknesses(m.profileKeyStats, keyStatKindChar), 5),
+		renderWeakestKeys("weakest pairs", rankKeyWeaknesses(m.profileKeyStats, keyStatKindBigram), 5),
+		strings.ToUpper(string(raceModeAdaptive)),
+	)
+}
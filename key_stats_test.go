@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_recordKeystroke(t *testing.T) {
+	t.Run("misses count against the expected key and the pair it finishes", func(t *testing.T) {
+		start := time.UnixMilli(0)
+		m := model{
+			raceWordsCharSlice: strings.Split("the", ""),
+			keyStats:           make(map[keyStatKey]*keyStat),
+		}
+		m = recordKeystroke(m, "t", "t", start)
+		m.correctPos++
+		m = recordKeystroke(m, "h", "j", start.Add(300*time.Millisecond))
+		got := m.keyStats[keyStatKey{kind: keyStatKindBigram, key: "th"}]
+		if got == nil || got.attempts != 1 || got.errors != 1 {
+			t.Fatalf("error, expected one missed attempt at 'th' but got %+v", got)
+		}
+		got = m.keyStats[keyStatKey{kind: keyStatKindChar, key: "t"}]
+		if got.latencySamples != 0 {
+			t.Errorf("error, expected the first key of a race to have no latency but got %+v", got)
+		}
+	})
+}
+
+func Test_buildAdaptiveWordList(t *testing.T) {
+	t.Run("words with weak keys show up more often", func(t *testing.T) {
+		stats := map[keyStatKey]*keyStat{
+			{kind: keyStatKindChar, key: "z"}: {attempts: 20, errors: 10},
+			{kind: keyStatKindChar, key: "a"}: {attempts: 20, errors: 0},
+		}
+		got := buildAdaptiveWordList([]string{"zap", "cat"}, stats)
+		counts := make(map[string]int)
+		for _, w := range got {
+			counts[w]++
+		}
+		if counts["zap"] <= counts["cat"] {
+			t.Errorf("error, expected 'zap' to show up more than 'cat' but got %v", counts)
+		}
+	})
+	t.Run("no stats means every word once", func(t *testing.T) {
+		got := buildAdaptiveWordList([]string{"zap", "cat"}, nil)
+		if len(got) != 2 {
+			t.Errorf("error, expected 2 words but got %v", got)
+		}
+	})
+}
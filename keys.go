@@ -0,0 +1,128 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// bubbleTeaPkgPath bubbletea hands over CSI sequences it doesn't recognize as an unexported []byte type from this package,
+// unknownCSISequenceMsg as of bubbletea v1.2.4. Test_unknownCSISequence_fromBubbleTea fails if that stops being true.
+var bubbleTeaPkgPath = reflect.TypeOf(tea.KeyMsg{}).PkgPath()
+
+// unknownCSISequence the parameters and final byte of a CSI sequence bubbletea didn't recognize, e.g. "32;2u"
+func unknownCSISequence(msg tea.Msg) (string, bool) {
+	v := reflect.ValueOf(msg)
+	if !v.IsValid() || v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Uint8 ||
+		v.Type().PkgPath() != bubbleTeaPkgPath {
+		return "", false
+	}
+	seq := string(v.Bytes())
+	if !strings.HasPrefix(seq, "\x1b[") {
+		return "", false
+	}
+	return strings.TrimPrefix(seq, "\x1b["), true
+}
+
+// keyModifiers the modifier parameter of a CSI key sequence is one more than a bit mask of these
+const (
+	keyModifierShift = 1 << iota
+	keyModifierAlt
+	keyModifierCtrl
+)
+
+// parseModifiedKey turns the CSI sequences terminals send for modified keys, either the kitty keyboard protocol
+// ("32;2u" for shift+space) or xterm's modifyOtherKeys ("27;2;32~"), into the key bubbletea would have sent
+// without the modifier. Shift is dropped from keys where it makes no difference, shifted letters are upper cased.
+// Anything else isn't a key a race cares about.
+func parseModifiedKey(seq string) (tea.KeyMsg, bool) {
+	var params []string
+	switch {
+	case strings.HasSuffix(seq, "u"):
+		params = strings.Split(strings.TrimSuffix(seq, "u"), ";")
+		if len(params) == 1 {
+			params = append(params, "1")
+		}
+	case strings.HasPrefix(seq, "27;") && strings.HasSuffix(seq, "~"):
+		params = strings.Split(strings.TrimSuffix(strings.TrimPrefix(seq, "27;"), "~"), ";")
+		if len(params) != 2 {
+			return tea.KeyMsg{}, false
+		}
+		params[0], params[1] = params[1], params[0]
+	default:
+		return tea.KeyMsg{}, false
+	}
+	if len(params) != 2 {
+		return tea.KeyMsg{}, false
+	}
+	code, err := strconv.Atoi(params[0])
+	if err != nil {
+		return tea.KeyMsg{}, false
+	}
+	modifiers, err := strconv.Atoi(params[1])
+	if err != nil || modifiers < 1 {
+		return tea.KeyMsg{}, false
+	}
+	modifiers--
+	if modifiers&^(keyModifierShift|keyModifierAlt|keyModifierCtrl) != 0 {
+		return tea.KeyMsg{}, false
+	}
+	alt := modifiers&keyModifierAlt != 0
+	ctrl := modifiers&keyModifierCtrl != 0
+	shift := modifiers&keyModifierShift != 0
+
+	var key tea.Key
+	switch r := rune(code); {
+	case ctrl && r >= 'a' && r <= 'z':
+		key = tea.Key{Type: tea.KeyCtrlA + tea.KeyType(r-'a')}
+	case ctrl:
+		return tea.KeyMsg{}, false
+	case r == ' ':
+		key = tea.Key{Type: tea.KeySpace, Runes: []rune{' '}}
+	case r == '\r':
+		key = tea.Key{Type: tea.KeyEnter}
+	case r == '\t':
+		key = tea.Key{Type: tea.KeyTab}
+	case r == 0x1b:
+		key = tea.Key{Type: tea.KeyEsc}
+	case r == 0x7f || r == '\b':
+		key = tea.Key{Type: tea.KeyBackspace}
+	case shift && unicode.IsLetter(r):
+		key = tea.Key{Type: tea.KeyRunes, Runes: []rune{unicode.ToUpper(r)}}
+	case shift:
+		// what shift does to anything other than a letter depends on the keyboard layout
+		return tea.KeyMsg{}, false
+	case unicode.IsPrint(r):
+		key = tea.Key{Type: tea.KeyRunes, Runes: []rune{r}}
+	default:
+		return tea.KeyMsg{}, false
+	}
+	key.Alt = alt
+	return tea.KeyMsg(key), true
+}
+
+// typedChars what a key types into a race. Keys that don't type anything (function keys, alt combinations,
+// pastes) aren't counted at all, rather than as a mistake. Keys typed quickly enough can arrive together.
+func typedChars(msg tea.KeyMsg, mode raceMode) []string {
+	if msg.Alt || msg.Paste {
+		return nil
+	}
+	switch msg.Type {
+	case tea.KeySpace:
+		return []string{" "}
+	case tea.KeyTab:
+		if mode == raceModeCode {
+			return []string{"\t"}
+		}
+	case tea.KeyRunes:
+		chars := make([]string, len(msg.Runes))
+		for i, r := range msg.Runes {
+			chars[i] = string(r)
+		}
+		return chars
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/timer"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func Test_parseModifiedKey(t *testing.T) {
+	tests := []struct {
+		seq    string
+		want   string
+		wantOk bool
+	}{
+		{seq: "32;2u", want: " ", wantOk: true},
+		{seq: "27;2;32~", want: " ", wantOk: true},
+		{seq: "97;2u", want: "A", wantOk: true},
+		{seq: "97u", want: "a", wantOk: true},
+		{seq: "119;5u", want: "ctrl+w", wantOk: true},
+		{seq: "27;5;117~", want: "ctrl+u", wantOk: true},
+		{seq: "127;3u", want: "alt+backspace", wantOk: true},
+		{seq: "13;2u", want: "enter", wantOk: true},
+		{seq: "27u", want: "esc", wantOk: true},
+		{seq: "49;2u", wantOk: false},
+		{seq: "97;9u", wantOk: false},
+		{seq: "1;5A", wantOk: false},
+		{seq: "15~", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.seq, func(t *testing.T) {
+			got, ok := parseModifiedKey(tt.seq)
+			if ok != tt.wantOk {
+				t.Fatalf("error, expected ok to be %v but got %v", tt.wantOk, ok)
+			}
+			if ok && got.String() != tt.want {
+				t.Errorf("error, expected %q but got %q", tt.want, got.String())
+			}
+		})
+	}
+}
+
+// lookalikeCSISequenceMsg shaped like the message bubbletea sends for unknown escape sequences, but from somewhere else
+type lookalikeCSISequenceMsg []byte
+
+func Test_Update_onlyKeysCountAsInput(t *testing.T) {
+	m := model{
+		activeView:         activeViewRace,
+		raceWordsCharSlice: strings.Split("ab cd ef", ""),
+		settings:           runtimeSettings(),
+	}
+	steps := []struct {
+		msg         tea.Msg
+		wantTyped   int
+		description string
+	}{
+		{msg: timer.TimeoutMsg{}, wantTyped: 0, description: "timer timeouts"},
+		{msg: tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'a'}}, wantTyped: 1, description: "a key"},
+		{msg: struct{}{}, wantTyped: 1, description: "unknown messages"},
+		{msg: spinner.TickMsg{}, wantTyped: 1, description: "spinner ticks"},
+		{msg: tea.FocusMsg{}, wantTyped: 1, description: "focus changes"},
+		{msg: tea.MouseMsg{}, wantTyped: 1, description: "the mouse"},
+		{msg: lookalikeCSISequenceMsg("\x1b[32;2u"), wantTyped: 1, description: "escape sequences from elsewhere"},
+		{msg: tea.KeyMsg{Type: tea.KeyF1}, wantTyped: 1, description: "function keys"},
+		{msg: tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'b'}, Alt: true}, wantTyped: 1, description: "alt combinations"},
+		{msg: tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'b'}, Paste: true}, wantTyped: 1, description: "pastes"},
+		{msg: tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'b'}}, wantTyped: 2, description: "another key"},
+		{msg: tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}}, wantTyped: 3, description: "space"},
+		{msg: tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'c', 'd'}}, wantTyped: 5, description: "keys that arrived together"},
+	}
+	for _, step := range steps {
+		updated, _ := m.Update(step.msg)
+		m = updated.(model)
+		if m.correctPos != step.wantTyped || m.incorrectPos != step.wantTyped {
+			t.Fatalf(
+				"error, after %s expected %d typed but got correct %d incorrect %d",
+				step.description, step.wantTyped, m.correctPos, m.incorrectPos,
+			)
+		}
+	}
+}
+
+// csiRecorder quits as soon as bubbletea hands it the message for an escape sequence
+type csiRecorder struct {
+	seq string
+	ok  bool
+}
+
+func (r csiRecorder) Init() tea.Cmd {
+	return nil
+}
+
+func (r csiRecorder) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if seq, ok := unknownCSISequence(msg); ok {
+		return csiRecorder{seq: seq, ok: true}, tea.Quit
+	}
+	return r, nil
+}
+
+func (r csiRecorder) View() string {
+	return ""
+}
+
+func Test_unknownCSISequence_fromBubbleTea(t *testing.T) {
+	p := tea.NewProgram(
+		csiRecorder{},
+		tea.WithInput(strings.NewReader("\x1b[32;2u")),
+		tea.WithOutput(io.Discard),
+		tea.WithoutRenderer(),
+		tea.WithoutSignalHandler(),
+	)
+	go func() {
+		// the input running out doesn't end the program, so give up rather than hang if the message never comes
+		time.Sleep(5 * time.Second)
+		p.Quit()
+	}()
+	final, err := p.Run()
+	if err != nil {
+		t.Fatalf("error, unexpected error: %v", err)
+	}
+	r := final.(csiRecorder)
+	if !r.ok || r.seq != "32;2u" {
+		t.Fatalf("error, expected bubbletea to hand over shift+space as an unknown CSI sequence but got %+v", r)
+	}
+	key, ok := parseModifiedKey(r.seq)
+	if !ok || key.Type != tea.KeySpace {
+		t.Errorf("error, expected shift+space to become a space but got %q", key.String())
+	}
+}
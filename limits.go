@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"golang.org/x/time/rate"
+)
+
+// rateLimiterIdleTimeout limiters that haven't been used in this long are forgotten, they would have refilled anyway
+const rateLimiterIdleTimeout = 10 * time.Minute
+
+var errTooManyRegistrations = errors.New("slow down, you're starting races too quickly, try again in a minute")
+
+type limiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter one token bucket per key, each allows perMinute events a minute with bursts up to the same
+type rateLimiter struct {
+	mu        sync.Mutex
+	limiters  map[string]*limiterEntry
+	lastSweep time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{limiters: make(map[string]*limiterEntry)}
+}
+
+// allow perMinute is passed on every call so reloaded limits apply to limiters that already exist
+func (r *rateLimiter) allow(key string, perMinute int, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now.Sub(r.lastSweep) > rateLimiterIdleTimeout {
+		for k, e := range r.limiters {
+			if now.Sub(e.lastSeen) > rateLimiterIdleTimeout {
+				delete(r.limiters, k)
+			}
+		}
+		r.lastSweep = now
+	}
+	limit := rate.Limit(float64(perMinute) / 60)
+	e, ok := r.limiters[key]
+	if !ok {
+		e = &limiterEntry{limiter: rate.NewLimiter(limit, perMinute)}
+		r.limiters[key] = e
+	} else if e.limiter.Limit() != limit || e.limiter.Burst() != perMinute {
+		// limits only change on a reload, starting over with a full bucket is simpler than carrying tokens across
+		e.limiter = rate.NewLimiter(limit, perMinute)
+	}
+	e.lastSeen = now
+	return e.limiter.AllowN(now, 1)
+}
+
+// sessionCounter how many sessions are open per key
+type sessionCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newSessionCounter() *sessionCounter {
+	return &sessionCounter{counts: make(map[string]int)}
+}
+
+// acquire every acquire that returns true needs a matching release
+func (c *sessionCounter) acquire(key string, max int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts[key] >= max {
+		return false
+	}
+	c.counts[key]++
+	return true
+}
+
+func (c *sessionCounter) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[key]--
+	if c.counts[key] <= 0 {
+		delete(c.counts, key)
+	}
+}
+
+var connectionLimiter = newRateLimiter()
+var registrationLimiter = newRateLimiter()
+var openSessions = newSessionCounter()
+
+// remoteIp falls back on the whole address when it can't be split
+func remoteIp(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// limitMiddleware turns away hosts and keys that connect too often or have too many sessions open at once
+func limitMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			limits := runtimeSettings().limits
+			now := time.Now()
+			ipKey := "ip:" + remoteIp(s.RemoteAddr())
+			if !connectionLimiter.allow(ipKey, limits.ConnectionsPerMinutePerIp, now) {
+				wish.Fatalln(s, "too many connections from your address, try again in a minute")
+				return
+			}
+			if !openSessions.acquire(ipKey, limits.MaxSessionsPerIp) {
+				wish.Fatalln(s, fmt.Sprintf("you already have %d sessions open from your address", limits.MaxSessionsPerIp))
+				return
+			}
+			defer openSessions.release(ipKey)
+			if s.PublicKey() != nil {
+				keyKey := "key:" + keyFingerprint(s.PublicKey())
+				if !connectionLimiter.allow(keyKey, limits.ConnectionsPerMinutePerKey, now) {
+					wish.Fatalln(s, "too many connections with your key, try again in a minute")
+					return
+				}
+				if !openSessions.acquire(keyKey, limits.MaxSessionsPerKey) {
+					wish.Fatalln(s, fmt.Sprintf("you already have %d sessions open with your key", limits.MaxSessionsPerKey))
+					return
+				}
+				defer openSessions.release(keyKey)
+			}
+			next(s)
+		}
+	}
+}
+
+// allowRaceRegistration registrations are limited by address and by key, guests only by address
+func allowRaceRegistration(m model) bool {
+	limits := runtimeSettings().limits
+	now := time.Now()
+	if !registrationLimiter.allow("ip:"+m.remoteIp, limits.RaceRegistrationsPerMinute, now) {
+		return false
+	}
+	if m.publicKey != nil && !registrationLimiter.allow("key:"+keyFingerprint(m.publicKey), limits.RaceRegistrationsPerMinute, now) {
+		return false
+	}
+	return true
+}
+
+// recordsResults whether the results of a race count towards the player's history and the leaderboards
+func recordsResults(m model) bool {
+	return !m.guest || !runtimeSettings().limits.ExcludeGuestsFromLeaderboards
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_rateLimiter_allow(t *testing.T) {
+	t.Run("bursts up to the limit then refills over the minute", func(t *testing.T) {
+		r := newRateLimiter()
+		now := time.Unix(1000, 0)
+		for i := 0; i < 3; i++ {
+			if !r.allow("ip:1.2.3.4", 3, now) {
+				t.Fatalf("error, expected connection %d to be allowed", i)
+			}
+		}
+		if r.allow("ip:1.2.3.4", 3, now) {
+			t.Errorf("error, expected the fourth connection to be turned away")
+		}
+		if !r.allow("ip:5.6.7.8", 3, now) {
+			t.Errorf("error, expected other addresses to be unaffected")
+		}
+		if !r.allow("ip:1.2.3.4", 3, now.Add(20*time.Second)) {
+			t.Errorf("error, expected a connection to be allowed once a token refilled")
+		}
+	})
+	t.Run("a raised limit applies straight away", func(t *testing.T) {
+		r := newRateLimiter()
+		now := time.Unix(1000, 0)
+		r.allow("key:a", 1, now)
+		if !r.allow("key:a", 5, now) {
+			t.Errorf("error, expected the raised limit to allow another connection")
+		}
+	})
+}
+
+func Test_sessionCounter(t *testing.T) {
+	c := newSessionCounter()
+	if !c.acquire("key:a", 1) {
+		t.Fatalf("error, expected the first session to be allowed")
+	}
+	if c.acquire("key:a", 1) {
+		t.Errorf("error, expected the second session to be turned away")
+	}
+	c.release("key:a")
+	if !c.acquire("key:a", 1) {
+		t.Errorf("error, expected a session to be allowed once the first closed")
+	}
+}
@@ -2,11 +2,10 @@ package main
 
 import (
 	"context"
-	"crypto/md5"
 	"encoding/base64"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net"
@@ -19,6 +18,7 @@ import (
 
 	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/stopwatch"
+	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/timer"
 	"github.com/muesli/termenv"
 
@@ -32,7 +32,6 @@ import (
 	"github.com/charmbracelet/wish/logging"
 
 	"github.com/charmbracelet/bubbles/spinner"
-	"github.com/google/uuid"
 	openai "github.com/sashabaranov/go-openai"
 	gossh "golang.org/x/crypto/ssh"
 
@@ -56,19 +55,6 @@ var regularStyle lipgloss.Style
 var cursorStyle lipgloss.Style
 var serviceName = "terminaltype"
 
-var sentencesPerTypingTest = 3
-var typingTestDesiredWidth = 60
-var raceStartTimeoutInSeconds = 10
-var raceTimeoutInSeconds = 180
-var maxPlayersPerRace = int8(5)
-var playerColors = []string{
-	"#00ff00",
-	"#ff5600",
-	"#0000ff",
-	"#ffff00",
-	"#ff00ff",
-}
-
 var theClients *clients.Clients
 
 const raceRegistrationRequestQueueId = "req_race_reg"
@@ -91,7 +77,36 @@ func main() {
 	// forces the color profile since its not getting applied sometimes
 	lipgloss.SetColorProfile(termenv.TrueColor)
 
-    config, err := config.New(ctx)
+    configPath := flag.String("config", "", "path to a local JSON or YAML config file")
+    flag.Usage = func() {
+        fmt.Fprintln(flag.CommandLine.Output(), cliUsage)
+        flag.PrintDefaults()
+    }
+    flag.Parse()
+
+    if flag.Arg(0) == "config" {
+        // checking config has to work when the config is broken so it comes before loading it
+        err := runConfigCli(flag.Args()[1:], *configPath, os.Stdout)
+        if err != nil {
+            log.Fatalf("error, when running config command for main(). Error: %v", err)
+        }
+        return
+    }
+
+    if flag.NArg() > 0 {
+        // admin commands, these don't start the server so only the database config has to be valid
+        config, err := config.NewForDatabase(ctx, *configPath)
+        if err != nil {
+            log.Fatalf("error, when creating new config for main(). Error: %v", err)
+        }
+        err = runCli(config.Database, flag.Args(), os.Stdout)
+        if err != nil {
+            log.Fatalf("error, when running command for main(). Error: %v", err)
+        }
+        return
+    }
+
+    config, err := config.New(ctx, *configPath)
     if err != nil {
         log.Fatalf("error, when creating new config for main(). Error: %v", err)
     }
@@ -118,11 +133,21 @@ func main() {
 
     chatClient = openai.NewClient(config.OpenAIAPIKey)
 
-    sentencesPerTypingTest = config.NumberOfSentencesPerTypingTest
-    typingTestDesiredWidth = config.TypingTestDesiredWidth
-    raceStartTimeoutInSeconds = config.RaceStartTimeoutInSeconds
-    maxPlayersPerRace = config.MaxPlayersPerRace
-    log.Printf("make players per race: %d", maxPlayersPerRace)
+    // before anything new is added, so the unique index sees every duplicate
+    err = renormalizeSentences()
+    if err != nil {
+        HandleUnexpectedError(nil, fmt.Errorf("error, when renormalizeSentences() for main(). Error: %v", err))
+        return
+    }
+
+    err = seedQuotes()
+    if err != nil {
+        HandleUnexpectedError(nil, fmt.Errorf("error, when seedQuotes() for main(). Error: %v", err))
+        return
+    }
+
+    currentSettings.Store(settingsFromConfig(config))
+    log.Printf("make players per race: %d", config.MaxPlayersPerRace)
 
     decodedKey, err := base64.StdEncoding.DecodeString(config.HostKey)
     if err != nil {
@@ -161,8 +186,12 @@ func main() {
         wish.WithAddress(net.JoinHostPort("0.0.0.0", strconv.Itoa(config.SSHPort))),
         wish.WithHostKeyPEM(decodedKey),
         wish.WithMiddleware(
-            bubbletea.Middleware(teaHandler),
+            programMiddleware(),
+            sessionMiddleware(),
             activeterm.Middleware(), // Bubble Tea apps usually require a PTY.
+            commandMiddleware(), // commands don't need one
+            identityMiddleware(),
+            limitMiddleware(),
             logging.Middleware(),
         ),
         wish.WithPublicKeyAuth(func(_ ssh.Context, key ssh.PublicKey) bool {
@@ -179,12 +208,14 @@ func main() {
         return
     }
 
-    textBaseStyle = lipgloss.NewStyle().Width(typingTestDesiredWidth)
+    textBaseStyle = lipgloss.NewStyle()
     correctStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#58bc54"))
     incorrectStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#ce4041"))
     regularStyle = lipgloss.NewStyle()
     cursorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#000000")).Background(lipgloss.Color("#ffffff"))
 
+    startCleanupRoutine(ctx)
+
     go func() {
         err1 := handleRaceRegistration(ctx)
         if err1 != nil {
@@ -193,6 +224,14 @@ func main() {
         }
     }()
 
+    go func() {
+        err5 := watchSettings(ctx, *configPath)
+        if err5 != nil {
+            HandleUnexpectedError(nil, fmt.Errorf("error, when watchSettings() for main(). Error: %v", err5))
+            return
+        }
+    }()
+
     go func() {
         err2 := ensureEnoughGeneratedText(ctx)
         if err2 != nil {
@@ -240,21 +279,30 @@ func teaHandler(s ssh.Session) (tea.Model, []tea.ProgramOption) {
 		tty:     pty.Slave,
 	}
 	renderer := bubbletea.MakeRenderer(sessionBridge)
-	fingerprint := uuid.New().String()
-	publicKey := s.PublicKey()
-	if publicKey != nil {
-		hash := md5.Sum(publicKey.Marshal())
-		fingerprint = hex.EncodeToString(hash[:])
+	identity, _ := s.Context().Value(identityContextKey).(sessionIdentity)
+	log.Printf("ssh fingerprint from client: %s", identity.id)
+	live, _ := s.Context().Value(liveSessionContextKey).(*liveSession)
+	prefs := defaultPreferences()
+	if !identity.guest {
+		var err error
+		prefs, err = fetchPreferences(identity.id)
+		if err != nil {
+			// the defaults will do for this session
+			HandleUnexpectedError(nil, fmt.Errorf("error, when fetchPreferences() for teaHandler(). Error: %v", err))
+		}
 	}
-	log.Printf("ssh fingerprint from client: %s", fingerprint)
-	model := NewModel(renderer, fingerprint)
+	model := NewModel(s.Context(), renderer, identity, live, prefs, s.PublicKey(), remoteIp(s.RemoteAddr()))
 	return model, []tea.ProgramOption{tea.WithAltScreen(), tea.WithMouseAllMotion()}
 }
 
 type model struct {
 	ctx                  context.Context
 	renderer             *lipgloss.Renderer
-	fingerprint          string
+	fingerprint          string // the player's identity id, a random id for guests
+	publicKey            ssh.PublicKey
+	remoteIp             string
+	guest                bool
+	username             string // empty until the player claims one
 	activeView           activeView
 	loading              bool
 	raceTicker           *stopwatch.Model
@@ -265,6 +313,8 @@ type model struct {
 	racerProgressBars    []progress.Model
 	raceCtx              context.Context // used for cleaning up all resources used in the race
 	raceCancel           context.CancelFunc
+	registration         *nats.Subscription // the lobby's answers arrive here while loading
+	registrationId       int                // tells the answers of the current lobby apart from one the player already left
 	spinner              spinner.Model
 	data                 modelData
 	raceWordsCharSlice   []string
@@ -274,29 +324,62 @@ type model struct {
 	incorrectPos         int
 	raceStartTime        int64
 	wordsPerMin          int
-	loadingFinished      chan modelData
+	raceOptions          raceOptions
+	selectedOptionRow    int
+	customWordsEditor    textarea.Model
+	settings             *settings // taken when the session starts and again each time the player joins a lobby
+	keyStats             map[keyStatKey]*keyStat // keystrokes for the current race, flushed to the database when it ends
+	lastKeyAt            time.Time
+	profileKeyStats      map[keyStatKey]*keyStat
+	account              accountState
+	preferences          preferences
+	mistakes             map[int]bool  // positions typed wrong in free flow, the cursor moved on without them being fixed
+	accuracy             float64       // of the last race
+	session              *liveSession  // nil outside of an ssh session
+	lastInputAt          time.Time     // the last key pressed anywhere, for working out whether the session is idle
+	dnfReason            string        // why the player was taken out of the last race, empty when they finished it
+	replayEvents         []replayEvent // keys pressed in the current race, saved with its result
+	replays              replayState
 }
 
 type modelData struct {
 	err              error
 	raceWords        string
-	wordCount        int8
+	wordCount        int
 	raceId           string // also the fingerprint print of user in the first race slot
 	racerCount       int8
 	allRacerProgress []RaceProgress
+	options          raceOptions
+	attribution      string
+	seed             int64
+	drillChunks      int
+	wordList         []string
 }
 
+// NewModel races are run under ctx so they are cleaned up when it ends
 func NewModel(
+	ctx context.Context,
 	renderer *lipgloss.Renderer,
-	fingerprint string,
+	identity sessionIdentity,
+	session *liveSession,
+	prefs preferences,
+	publicKey ssh.PublicKey,
+	remoteIp string,
 ) tea.Model {
-	ctx := context.Background()
 	m := model{
 		ctx:             ctx,
 		renderer:        renderer,
-		fingerprint:     fingerprint,
+		fingerprint:     identity.id,
+		username:        identity.username,
+		publicKey:       publicKey,
+		remoteIp:        remoteIp,
+		guest:           identity.guest,
+		session:         session,
+		preferences:     prefs,
+		lastInputAt:     time.Now(),
 		activeView:      activeViewWelcome,
-		loadingFinished: make(chan modelData, 1),
+		settings:        runtimeSettings(),
+		raceOptions:     defaultRaceOptions(),
 	}
 	m.resetSpinner()
 	return m
@@ -370,14 +453,39 @@ func handleRaceRegistration(ctx context.Context) error {
 	}
 	defer sub.Unsubscribe()
 	defer close(subChan)
-	rr := RaceRegistration{
-		AllRaceProgress: make([]RaceProgress, maxPlayersPerRace),
-	}
+	// one lobby per set of race options so players only race others who picked the same options
+	lobbies := make(map[string]*RaceRegistration)
 	ticker := time.Tick(time.Second)
 	for {
 		select {
 		case natsMsg := <-subChan:
-			f := string(natsMsg.Data)
+			var req RegRequest
+			err = json.Unmarshal(natsMsg.Data, &req)
+			if err != nil {
+				// a bad request shouldn't take registration down for everybody else
+				HandleUnexpectedError(nil, fmt.Errorf("error, when decoding RegRequest for handleRaceRegistration(). Error: %v", err))
+				continue
+			}
+			f := req.Fingerprint
+			options := req.Options.normalize()
+			lobbyKey := options.lobbyKey(f)
+			if req.Leave {
+				if rr, ok := lobbies[lobbyKey]; ok && rr.removeRacer(f) && rr.RacerCount == 0 {
+					delete(lobbies, lobbyKey)
+				}
+				continue
+			}
+			rr, ok := lobbies[lobbyKey]
+			if !ok {
+				// the lobby keeps the settings it was opened with even if they are reloaded before the race starts
+				s := runtimeSettings()
+				rr = &RaceRegistration{
+					Options:         options,
+					AllRaceProgress: make([]RaceProgress, s.maxPlayersPerRace),
+					RaceStartTime:   int64(s.raceStartTimeoutInSeconds) + time.Now().Unix(),
+				}
+				lobbies[lobbyKey] = rr
+			}
 			var racerAlreadyRegistered bool
 			for _, theRacer := range rr.AllRaceProgress {
 				if theRacer.Fingerprint == f {
@@ -387,9 +495,9 @@ func handleRaceRegistration(ctx context.Context) error {
 			if !racerAlreadyRegistered {
 				rr.AllRaceProgress[rr.RacerCount].Fingerprint = f
 				rr.AllRaceProgress[rr.RacerCount].RacerId = int8(rr.RacerCount)
+				rr.AllRaceProgress[rr.RacerCount].Username = req.Username
 				if rr.RacerCount == 0 {
 					rr.RaceId = f
-					rr.RaceStartTime = int64(raceStartTimeoutInSeconds) + time.Now().Unix()
 				}
 				rr.RacerCount++
 			}
@@ -406,23 +514,21 @@ func handleRaceRegistration(ctx context.Context) error {
 			if err != nil {
 				return fmt.Errorf("error, when sending raceRegistrationStartTime to racer for handleRaceRegistration(). Error: %v", err)
 			}
-			if rr.RacerCount == maxPlayersPerRace {
-				err = publishRace(conn, rr)
+			if int(rr.RacerCount) == len(rr.AllRaceProgress) {
+				err = publishRace(conn, *rr)
 				if err != nil {
 					return fmt.Errorf("error, when publishRace() for handleRaceRegistration() max player count was reached. Error: %v", err)
 				}
-				rr = RaceRegistration{
-					AllRaceProgress: make([]RaceProgress, maxPlayersPerRace),
-				}
+				delete(lobbies, lobbyKey)
 			}
 		case <-ticker:
-			if rr.RacerCount != 0 && time.Now().Unix() >= rr.RaceStartTime {
-				err = publishRace(conn, rr)
-				if err != nil {
-					return fmt.Errorf("error, when publishRace() for handleRaceRegistration() after race timeout exceeded. Error: %v", err)
-				}
-				rr = RaceRegistration{
-					AllRaceProgress: make([]RaceProgress, maxPlayersPerRace),
+			for lobbyKey, rr := range lobbies {
+				if time.Now().Unix() >= rr.RaceStartTime {
+					err = publishRace(conn, *rr)
+					if err != nil {
+						return fmt.Errorf("error, when publishRace() for handleRaceRegistration() after race timeout exceeded. Error: %v", err)
+					}
+					delete(lobbies, lobbyKey)
 				}
 			}
 		case <-ctx.Done():
@@ -431,14 +537,48 @@ func handleRaceRegistration(ctx context.Context) error {
 	}
 }
 
+// removeRacer frees up the racer's slot, everyone after them moves up one. Returns false when they weren't in the lobby.
+func (rr *RaceRegistration) removeRacer(fingerprint string) bool {
+	slot := -1
+	for i := int8(0); i < rr.RacerCount; i++ {
+		if rr.AllRaceProgress[i].Fingerprint == fingerprint {
+			slot = int(i)
+		}
+	}
+	if slot == -1 {
+		return false
+	}
+	copy(rr.AllRaceProgress[slot:], rr.AllRaceProgress[slot+1:])
+	rr.AllRaceProgress[len(rr.AllRaceProgress)-1] = RaceProgress{}
+	rr.RacerCount--
+	for i := int8(0); i < rr.RacerCount; i++ {
+		rr.AllRaceProgress[i].RacerId = i
+	}
+	// the race is named after whoever is in the first slot
+	rr.RaceId = rr.AllRaceProgress[0].Fingerprint
+	return true
+}
+
 func publishRace(conn *nats.Conn, rr RaceRegistration) error {
 	// start race, for now but todo try to join one first if one is available
-	raceWords, wordCount, err := fetchRaceWords()
+	racerFingerprints := make([]string, rr.RacerCount)
+	for i := int8(0); i < rr.RacerCount; i++ {
+		racerFingerprints[i] = rr.AllRaceProgress[i].Fingerprint
+	}
+	text, err := fetchRaceText(rr.Options, racerFingerprints)
 	if err != nil {
-		err = fmt.Errorf("error, when fetchRaceWords() for publishRace(). Error: %v", err)
+		// returning would stop registration for everyone, the lobby is told instead so nobody races an empty text
+		HandleUnexpectedError(nil, fmt.Errorf("error, when fetchRaceText() for publishRace(). Error: %v", err))
+		rr.Error = errRaceSetupFailed.Error()
 	}
-	rr.RaceWords = raceWords
-	rr.WordCount = wordCount
+	rr.RaceWords = text.text
+	rr.WordCount = text.wordCount
+	rr.Attribution = text.attribution
+	rr.Seed = text.seed
+	rr.DrillChunks = text.drillChunks
+	rr.WordList = text.wordList
+	// taken after the text is fetched so every racer sees the whole countdown
+	rr.GoTime = time.Now().Add(raceCountdown).UnixMilli()
 	encodedRace, err := encodeRaceRegistration(rr)
 	if err != nil {
 		return fmt.Errorf("error, when encodeAllRaceProgress() for handleRaceRegistration(). Error: %v", err)
@@ -0,0 +1,24 @@
+ALTER TABLE sentence ADD COLUMN normalized_text TEXT NOT NULL DEFAULT '';
+ALTER TABLE sentence ADD COLUMN source TEXT NOT NULL DEFAULT 'openai';
+ALTER TABLE sentence ADD COLUMN char_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE sentence ADD COLUMN word_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE sentence ADD COLUMN difficulty REAL NOT NULL DEFAULT 0;
+ALTER TABLE sentence ADD COLUMN times_served INTEGER NOT NULL DEFAULT 0;
+
+UPDATE sentence
+SET normalized_text = lower(trim(text)),
+    char_count = length(trim(text)),
+    word_count = length(trim(text)) - length(replace(trim(text), ' ', '')) + 1;
+
+DELETE FROM sentence
+WHERE id NOT IN (
+    SELECT MIN(id)
+    FROM sentence
+    GROUP BY normalized_text
+);
+
+CREATE UNIQUE INDEX idx_sentence_normalized_text
+ON sentence (normalized_text);
+
+CREATE INDEX idx_sentence_times_served
+ON sentence (times_served);
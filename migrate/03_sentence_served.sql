@@ -0,0 +1,10 @@
+CREATE TABLE sentence_served (
+   ssh_finger_print TEXT NOT NULL,
+   sentence_id INTEGER NOT NULL,
+   served_count INTEGER NOT NULL DEFAULT 1,
+   last_served_at INTEGER NOT NULL,
+   PRIMARY KEY (ssh_finger_print, sentence_id)
+);
+
+CREATE INDEX idx_sentence_served_sentence_id
+ON sentence_served (sentence_id);
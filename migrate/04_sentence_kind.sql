@@ -0,0 +1,6 @@
+ALTER TABLE sentence ADD COLUMN kind TEXT NOT NULL DEFAULT 'sentence';
+ALTER TABLE sentence ADD COLUMN author TEXT NOT NULL DEFAULT '';
+ALTER TABLE sentence ADD COLUMN work TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX idx_sentence_kind
+ON sentence (kind);
@@ -0,0 +1,5 @@
+CREATE TABLE custom_word_list (
+   ssh_finger_print TEXT PRIMARY KEY,
+   words TEXT NOT NULL,
+   updated_at INTEGER NOT NULL
+);
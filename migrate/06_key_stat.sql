@@ -0,0 +1,10 @@
+CREATE TABLE key_stat (
+   ssh_finger_print TEXT NOT NULL,
+   kind TEXT NOT NULL,
+   key TEXT NOT NULL,
+   attempts INTEGER NOT NULL,
+   errors INTEGER NOT NULL,
+   total_latency_ms INTEGER NOT NULL,
+   latency_samples INTEGER NOT NULL,
+   PRIMARY KEY (ssh_finger_print, kind, key)
+);
@@ -0,0 +1,23 @@
+CREATE TABLE identity (
+   id TEXT PRIMARY KEY,
+   username TEXT,
+   created_at INTEGER NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_identity_username
+ON identity (username COLLATE NOCASE);
+
+CREATE TABLE identity_key (
+   key_fingerprint TEXT PRIMARY KEY,
+   identity_id TEXT NOT NULL,
+   linked_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_identity_key_identity_id
+ON identity_key (identity_id);
+
+CREATE TABLE link_code (
+   code TEXT PRIMARY KEY,
+   identity_id TEXT NOT NULL,
+   expires_at INTEGER NOT NULL
+);
@@ -0,0 +1,17 @@
+CREATE TABLE player (
+   identity_id TEXT PRIMARY KEY,
+   username TEXT NOT NULL,
+   claimed_at INTEGER NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_player_username
+ON player (username COLLATE NOCASE);
+
+INSERT INTO player (identity_id, username, claimed_at)
+SELECT id, username, created_at
+FROM identity
+WHERE username IS NOT NULL;
+
+DROP INDEX idx_identity_username;
+
+ALTER TABLE identity DROP COLUMN username;
@@ -0,0 +1,11 @@
+CREATE TABLE race_result (
+   id INTEGER PRIMARY KEY,
+   ssh_finger_print TEXT NOT NULL,
+   race_id TEXT NOT NULL,
+   mode TEXT NOT NULL,
+   words_per_min INTEGER NOT NULL,
+   percentage_complete REAL NOT NULL,
+   did_not_finish INTEGER NOT NULL,
+   finished_at INTEGER NOT NULL
+);
+CREATE INDEX idx_race_result_finger_print ON race_result (ssh_finger_print, finished_at);
@@ -0,0 +1,5 @@
+CREATE TABLE preference (
+   ssh_finger_print TEXT PRIMARY KEY,
+   confine_errors_to_word INTEGER NOT NULL DEFAULT 0,
+   updated_at INTEGER NOT NULL
+);
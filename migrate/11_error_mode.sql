@@ -0,0 +1,3 @@
+ALTER TABLE preference ADD COLUMN error_mode TEXT NOT NULL DEFAULT 'correct';
+ALTER TABLE race_result ADD COLUMN error_mode TEXT NOT NULL DEFAULT 'correct';
+ALTER TABLE race_result ADD COLUMN accuracy REAL NOT NULL DEFAULT 1;
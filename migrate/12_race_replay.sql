@@ -0,0 +1,5 @@
+CREATE TABLE race_replay (
+   race_result_id INTEGER PRIMARY KEY,
+   text TEXT NOT NULL,
+   events TEXT NOT NULL
+);
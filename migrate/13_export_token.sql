@@ -0,0 +1,5 @@
+CREATE TABLE export_token (
+   identity_id TEXT PRIMARY KEY,
+   token_hash TEXT NOT NULL UNIQUE,
+   created_at INTEGER NOT NULL
+);
@@ -6,10 +6,12 @@ import (
 
 type Models struct {
     Healthy *HealthyModel
+    RaceHistory *RaceHistoryModel
 }
 
 func New(clients *clients.Clients) *Models {
     return &Models{
         Healthy: NewHealthyModel(clients),
+        RaceHistory: NewRaceHistoryModel(clients),
     }
 }
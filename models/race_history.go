@@ -0,0 +1,162 @@
+package models
+
+import (
+    "crypto/rand"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/csv"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "strconv"
+    "time"
+
+    "github.com/JeremiahVaughan/terminaltype/clients"
+    "github.com/JeremiahVaughan/terminaltype/clients/database"
+)
+
+const (
+    RaceHistoryFormatCsv = "csv"
+    RaceHistoryFormatJson = "json"
+)
+
+var ErrUnknownRaceHistoryFormat = errors.New("the format has to be csv or json")
+
+// RaceHistoryEntry one row of an export, the same columns are used for csv and json
+type RaceHistoryEntry struct {
+    FinishedAt time.Time `json:"finishedAt"`
+    RaceId string `json:"raceId"`
+    Mode string `json:"mode"`
+    ErrorMode string `json:"errorMode"`
+    WordsPerMin int `json:"wordsPerMin"`
+    Accuracy float64 `json:"accuracy"`
+    PercentageComplete float64 `json:"percentageComplete"`
+    DidNotFinish bool `json:"didNotFinish"`
+}
+
+var raceHistoryCsvHeader = []string{"finished_at", "race_id", "mode", "error_mode", "words_per_min", "accuracy", "percentage_complete", "did_not_finish"}
+
+type RaceHistoryModel struct {
+    db *database.Client
+}
+
+func NewRaceHistoryModel(clients *clients.Clients) *RaceHistoryModel {
+    return &RaceHistoryModel{
+        db: clients.Database,
+    }
+}
+
+// Fetch the player's races oldest first, so a spreadsheet reads top to bottom
+func (m *RaceHistoryModel) Fetch(identityId string) ([]RaceHistoryEntry, error) {
+    rows, err := m.db.Conn.Query(
+        `SELECT finished_at, race_id, mode, error_mode, words_per_min, accuracy, percentage_complete, did_not_finish
+FROM race_result
+WHERE ssh_finger_print = ?
+ORDER BY finished_at, id`,
+        identityId,
+    )
+    if err != nil {
+        return nil, fmt.Errorf("error, when querying race results for Fetch(). Error: %v", err)
+    }
+    defer rows.Close()
+    var result []RaceHistoryEntry
+    for rows.Next() {
+        var e RaceHistoryEntry
+        var finishedAt int64
+        err = rows.Scan(&finishedAt, &e.RaceId, &e.Mode, &e.ErrorMode, &e.WordsPerMin, &e.Accuracy, &e.PercentageComplete, &e.DidNotFinish)
+        if err != nil {
+            return nil, fmt.Errorf("error, when scanning race results for Fetch(). Error: %v", err)
+        }
+        e.FinishedAt = time.Unix(finishedAt, 0).UTC()
+        result = append(result, e)
+    }
+    err = rows.Err()
+    if err != nil {
+        return nil, fmt.Errorf("error, when reading race results for Fetch(). Error: %v", err)
+    }
+    return result, nil
+}
+
+// Write ErrUnknownRaceHistoryFormat when format isn't csv or json
+func (m *RaceHistoryModel) Write(w io.Writer, format string, entries []RaceHistoryEntry) error {
+    switch format {
+    case RaceHistoryFormatCsv:
+        csvWriter := csv.NewWriter(w)
+        err := csvWriter.Write(raceHistoryCsvHeader)
+        if err != nil {
+            return fmt.Errorf("error, when writing csv header. Error: %v", err)
+        }
+        for _, e := range entries {
+            err = csvWriter.Write([]string{
+                e.FinishedAt.Format(time.RFC3339),
+                e.RaceId,
+                e.Mode,
+                e.ErrorMode,
+                strconv.Itoa(e.WordsPerMin),
+                strconv.FormatFloat(e.Accuracy, 'f', 4, 64),
+                strconv.FormatFloat(e.PercentageComplete, 'f', 4, 64),
+                strconv.FormatBool(e.DidNotFinish),
+            })
+            if err != nil {
+                return fmt.Errorf("error, when writing csv row. Error: %v", err)
+            }
+        }
+        csvWriter.Flush()
+        return csvWriter.Error()
+    case RaceHistoryFormatJson:
+        if entries == nil {
+            entries = []RaceHistoryEntry{}
+        }
+        encoder := json.NewEncoder(w)
+        encoder.SetIndent("", "  ")
+        return encoder.Encode(entries)
+    default:
+        return ErrUnknownRaceHistoryFormat
+    }
+}
+
+// CreateDownloadToken replaces whatever token the player had, only a hash of it is kept
+func (m *RaceHistoryModel) CreateDownloadToken(identityId string) (string, error) {
+    b := make([]byte, 24)
+    _, err := rand.Read(b)
+    if err != nil {
+        return "", fmt.Errorf("error, when generating download token. Error: %v", err)
+    }
+    token := hex.EncodeToString(b)
+    _, err = m.db.Conn.Exec(
+        `INSERT INTO export_token (identity_id, token_hash, created_at) VALUES (?, ?, ?)
+ON CONFLICT (identity_id) DO UPDATE
+SET token_hash = excluded.token_hash,
+    created_at = excluded.created_at`,
+        identityId,
+        hashDownloadToken(token),
+        time.Now().Unix(),
+    )
+    if err != nil {
+        return "", fmt.Errorf("error, when saving download token. Error: %v", err)
+    }
+    return token, nil
+}
+
+// IdentityForDownloadToken empty when the token isn't one that was handed out
+func (m *RaceHistoryModel) IdentityForDownloadToken(token string) (string, error) {
+    var identityId string
+    err := m.db.Conn.QueryRow(
+        `SELECT identity_id FROM export_token WHERE token_hash = ?`,
+        hashDownloadToken(token),
+    ).Scan(&identityId)
+    if errors.Is(err, sql.ErrNoRows) {
+        return "", nil
+    }
+    if err != nil {
+        return "", fmt.Errorf("error, when querying download token. Error: %v", err)
+    }
+    return identityId, nil
+}
+
+func hashDownloadToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+    "strings"
+    "testing"
+
+    "github.com/JeremiahVaughan/terminaltype/clients"
+    "github.com/JeremiahVaughan/terminaltype/clients/database"
+    "github.com/JeremiahVaughan/terminaltype/config"
+)
+
+func newTestRaceHistoryModel(t *testing.T) *RaceHistoryModel {
+    t.Helper()
+    db, err := database.New(config.Database{DataDirectory: t.TempDir(), MigrationDirectory: "../migrate"})
+    if err != nil {
+        t.Fatalf("error, when creating test database: %v", err)
+    }
+    t.Cleanup(func() {
+        db.Conn.Close()
+    })
+    return NewRaceHistoryModel(&clients.Clients{Database: db})
+}
+
+func Test_RaceHistoryModel_Write(t *testing.T) {
+    m := newTestRaceHistoryModel(t)
+    _, err := m.db.Conn.Exec(
+        `INSERT INTO race_result (ssh_finger_print, race_id, mode, words_per_min, percentage_complete, did_not_finish, finished_at, error_mode, accuracy)
+VALUES ('me', 'second', 'words', 0, 0.5, 1, 200, 'stop', 0.9),
+       ('me', 'first', 'sentences', 71, 1, 0, 100, 'correct', 0.975),
+       ('someone else', 'theirs', 'words', 90, 1, 0, 150, 'correct', 1)`,
+    )
+    if err != nil {
+        t.Fatalf("error, when inserting race results: %v", err)
+    }
+    entries, err := m.Fetch("me")
+    if err != nil {
+        t.Fatalf("error, unexpected error: %v", err)
+    }
+
+    tests := []struct {
+        name string
+        format string
+        entries []RaceHistoryEntry
+        want string
+    }{
+        {
+            name: "csv oldest first",
+            format: RaceHistoryFormatCsv,
+            entries: entries,
+            want: "finished_at,race_id,mode,error_mode,words_per_min,accuracy,percentage_complete,did_not_finish\n" +
+                "1970-01-01T00:01:40Z,first,sentences,correct,71,0.9750,1.0000,false\n" +
+                "1970-01-01T00:03:20Z,second,words,stop,0,0.9000,0.5000,true\n",
+        },
+        {
+            name: "json oldest first",
+            format: RaceHistoryFormatJson,
+            entries: entries[:1],
+            want: `[
+  {
+    "finishedAt": "1970-01-01T00:01:40Z",
+    "raceId": "first",
+    "mode": "sentences",
+    "errorMode": "correct",
+    "wordsPerMin": 71,
+    "accuracy": 0.975,
+    "percentageComplete": 1,
+    "didNotFinish": false
+  }
+]
+`,
+        },
+        {name: "an empty csv still has its header", format: RaceHistoryFormatCsv, want: strings.Join(raceHistoryCsvHeader, ",") + "\n"},
+        {name: "an empty json history is an empty list", format: RaceHistoryFormatJson, want: "[]\n"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var b strings.Builder
+            err := m.Write(&b, tt.format, tt.entries)
+            if err != nil {
+                t.Fatalf("error, unexpected error: %v", err)
+            }
+            if b.String() != tt.want {
+                t.Errorf("error, expected:\n%s\nbut got:\n%s", tt.want, b.String())
+            }
+        })
+    }
+    if err := m.Write(&strings.Builder{}, "xlsx", entries); err != ErrUnknownRaceHistoryFormat {
+        t.Errorf("error, expected ErrUnknownRaceHistoryFormat but got %v", err)
+    }
+}
+
+func Test_RaceHistoryModel_CreateDownloadToken(t *testing.T) {
+    m := newTestRaceHistoryModel(t)
+    old, err := m.CreateDownloadToken("me")
+    if err != nil {
+        t.Fatalf("error, unexpected error: %v", err)
+    }
+    if id, _ := m.IdentityForDownloadToken(old); id != "me" {
+        t.Fatalf("error, expected the token to belong to me but got %q", id)
+    }
+    current, err := m.CreateDownloadToken("me")
+    if err != nil {
+        t.Fatalf("error, unexpected error: %v", err)
+    }
+    if current == old {
+        t.Fatalf("error, expected a different token every time")
+    }
+    if id, err := m.IdentityForDownloadToken(old); id != "" || err != nil {
+        t.Errorf("error, expected the old token to stop working but it belongs to %q (%v)", id, err)
+    }
+    if id, _ := m.IdentityForDownloadToken(current); id != "me" {
+        t.Errorf("error, expected the new token to belong to me but got %q", id)
+    }
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/google/uuid"
+	"github.com/ncruces/go-sqlite3"
+)
+
+var usernameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{3,20}$`)
+
+// reservedUsernames can't be claimed. Most are what ssh sends when nobody picked a name (the local account name),
+// connecting as one of these never claims or checks anything.
+var reservedUsernames = toWordSet([]string{
+	"admin", "administrator", "root", "guest", "play", "player", "terminaltype", "system", "support",
+	"moderator", "mod", "anonymous", "nobody", "user", "ubuntu", "ec2-user", "pi", "git", "test", "null",
+})
+
+var (
+	errUsernameInvalid  = errors.New("usernames are 3 to 20 letters, numbers, dashes or underscores")
+	errUsernameReserved = errors.New("that username is reserved")
+	errUsernameTaken    = errors.New("that username is taken")
+)
+
+type contextKey string
+
+const identityContextKey contextKey = "identity"
+
+// sessionIdentity who is on the other end of an ssh session, worked out before the game starts
+type sessionIdentity struct {
+	id       string
+	username string
+	guest    bool
+}
+
+// identityMiddleware works out who the player is. Connecting as a claimed username with a key that isn't linked to
+// the account that claimed it ends the session. Connecting as an unclaimed username claims it for a player who
+// doesn't have one yet.
+func identityMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			identity, err := identifySession(s.User(), s.PublicKey())
+			var impersonation impersonationError
+			if errors.As(err, &impersonation) {
+				wish.Fatalln(s, impersonation.Error())
+				return
+			}
+			if err != nil {
+				HandleUnexpectedError(nil, fmt.Errorf("error, when identifySession() for identityMiddleware(). Error: %v", err))
+				wish.Fatalln(s, "something went wrong, try again")
+				return
+			}
+			s.Context().SetValue(identityContextKey, identity)
+			next(s)
+		}
+	}
+}
+
+type impersonationError struct {
+	username string
+}
+
+func (e impersonationError) Error() string {
+	return fmt.Sprintf(
+		"the username %s belongs to someone else, connect with a different one (e.g. ssh play@terminaltype.com).\n"+
+			"If it's yours and this is a new key, link it first: connect with a key you already use, press A then G "+
+			"for a link code, then connect with this key as play@terminaltype.com, press A then L and enter the code.",
+		e.username,
+	)
+}
+
+func identifySession(requestedUsername string, key ssh.PublicKey) (sessionIdentity, error) {
+	checkUsername := usernameRegex.MatchString(requestedUsername) && !isReservedUsername(requestedUsername)
+	var owner string
+	if checkUsername {
+		var err error
+		owner, err = fetchUsernameOwner(requestedUsername)
+		if err != nil {
+			return sessionIdentity{}, fmt.Errorf("error, when fetchUsernameOwner() for identifySession(). Error: %v", err)
+		}
+	}
+	if key == nil {
+		if owner != "" {
+			return sessionIdentity{}, impersonationError{username: requestedUsername}
+		}
+		return sessionIdentity{id: uuid.New().String(), guest: true}, nil
+	}
+
+	id, err := resolveIdentity(key)
+	if err != nil {
+		return sessionIdentity{}, fmt.Errorf("error, when resolveIdentity() for identifySession(). Error: %v", err)
+	}
+	if owner != "" && owner != id {
+		return sessionIdentity{}, impersonationError{username: requestedUsername}
+	}
+	username, err := fetchUsername(id)
+	if err != nil {
+		return sessionIdentity{}, fmt.Errorf("error, when fetchUsername() for identifySession(). Error: %v", err)
+	}
+	if checkUsername && owner == "" && username == "" {
+		err = claimUsername(id, requestedUsername)
+		if err != nil && !errors.Is(err, errUsernameTaken) {
+			return sessionIdentity{}, fmt.Errorf("error, when claimUsername() for identifySession(). Error: %v", err)
+		}
+		if err == nil {
+			username = requestedUsername
+		}
+	}
+	return sessionIdentity{id: id, username: username}, nil
+}
+
+func isReservedUsername(username string) bool {
+	return reservedUsernames[strings.ToLower(username)]
+}
+
+// claimUsername replaces any username the identity already had
+func claimUsername(identityId string, username string) error {
+	username = strings.TrimSpace(username)
+	if !usernameRegex.MatchString(username) {
+		return errUsernameInvalid
+	}
+	if isReservedUsername(username) {
+		return errUsernameReserved
+	}
+	// the unique index on username decides who gets it, checking first would leave a gap for two sessions to claim it at once
+	_, err := theClients.Database.Conn.Exec(
+		`INSERT INTO player (identity_id, username, claimed_at)
+VALUES (?, ?, ?)
+ON CONFLICT (identity_id) DO UPDATE
+SET username = excluded.username,
+	claimed_at = excluded.claimed_at`,
+		identityId,
+		username,
+		time.Now().Unix(),
+	)
+	if errors.Is(err, sqlite3.CONSTRAINT_UNIQUE) {
+		return errUsernameTaken
+	}
+	if err != nil {
+		return fmt.Errorf("error, when upserting player for claimUsername(). Error: %v", err)
+	}
+	return nil
+}
+
+// fetchUsernameOwner the identity id that claimed the username, empty when nobody has. Case doesn't matter.
+func fetchUsernameOwner(username string) (string, error) {
+	var owner string
+	err := theClients.Database.Conn.QueryRow(
+		`SELECT identity_id FROM player WHERE username = ? COLLATE NOCASE`,
+		username,
+	).Scan(&owner)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("error, when querying player for fetchUsernameOwner(). Error: %v", err)
+	}
+	return owner, nil
+}
+
+func fetchUsername(identityId string) (string, error) {
+	var username string
+	err := theClients.Database.Conn.QueryRow(
+		`SELECT username FROM player WHERE identity_id = ?`,
+		identityId,
+	).Scan(&username)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("error, when querying player for fetchUsername(). Error: %v", err)
+	}
+	return username, nil
+}
+
+// racerName what other racers see, players who haven't claimed a username go by their slot
+func racerName(p RaceProgress) string {
+	if p.Username != "" {
+		return p.Username
+	}
+	return fmt.Sprintf("player %d", p.RacerId)
+}
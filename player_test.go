@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+func Test_racerName(t *testing.T) {
+	t.Run("claimed username", func(t *testing.T) {
+		got := racerName(RaceProgress{RacerId: 1, Username: "alice"})
+		if got != "alice" {
+			t.Errorf("error, expected 'alice' but got '%s'", got)
+		}
+	})
+	t.Run("no username falls back on the slot", func(t *testing.T) {
+		got := racerName(RaceProgress{RacerId: 2})
+		if got != "player 2" {
+			t.Errorf("error, expected 'player 2' but got '%s'", got)
+		}
+	})
+}
+
+func Test_processRacerProgressMsgs(t *testing.T) {
+	t.Run("racers can only report their progress, not who they are", func(t *testing.T) {
+		progress := []RaceProgress{{RacerId: 0, Fingerprint: "a", Username: "alice"}}
+		data, err := encodeRaceProgress(RaceProgress{RacerId: 0, Fingerprint: "b", Username: "mallory", PercentageComplete: 0.5})
+		if err != nil {
+			t.Fatalf("error, unexpected error: %v", err)
+		}
+		messages := make(chan *nats.Msg, 2)
+		messages <- &nats.Msg{Data: data}
+		outOfRange, _ := encodeRaceProgress(RaceProgress{RacerId: 4, PercentageComplete: 1})
+		messages <- &nats.Msg{Data: outOfRange}
+		got, err := processRacerProgressMsgs(messages, progress)
+		if err != nil {
+			t.Fatalf("error, unexpected error: %v", err)
+		}
+		want := RaceProgress{RacerId: 0, Fingerprint: "a", Username: "alice", PercentageComplete: 0.5}
+		if got[0] != want {
+			t.Errorf("error, expected %+v but got %+v", want, got[0])
+		}
+	})
+	t.Run("racers who leave are marked as not finishing", func(t *testing.T) {
+		progress := []RaceProgress{{RacerId: 0, Fingerprint: "a"}, {RacerId: 1, Fingerprint: "b"}}
+		data, err := encodeRaceProgress(RaceProgress{RacerId: 1, PercentageComplete: 0.25, DidNotFinish: true})
+		if err != nil {
+			t.Fatalf("error, unexpected error: %v", err)
+		}
+		messages := make(chan *nats.Msg, 1)
+		messages <- &nats.Msg{Data: data}
+		got, err := processRacerProgressMsgs(messages, progress)
+		if err != nil {
+			t.Fatalf("error, unexpected error: %v", err)
+		}
+		if !got[1].DidNotFinish || got[1].PercentageComplete != 0.25 {
+			t.Errorf("error, expected racer 1 to not finish at 25%% but got %+v", got[1])
+		}
+		if got[0].DidNotFinish {
+			t.Errorf("error, expected racer 0 to be unaffected")
+		}
+	})
+}
+
+func Test_claimUsername(t *testing.T) {
+	newTestDatabase(t)
+	alice, err := resolveIdentity(newTestKey(t))
+	if err != nil {
+		t.Fatalf("error, unexpected error: %v", err)
+	}
+	bob, err := resolveIdentity(newTestKey(t))
+	if err != nil {
+		t.Fatalf("error, unexpected error: %v", err)
+	}
+	steps := []struct {
+		description string
+		identityId  string
+		username    string
+		wantErr     error
+	}{
+		{description: "a free name", identityId: alice, username: "alice"},
+		{description: "someone else's name in another case", identityId: bob, username: "ALICE", wantErr: errUsernameTaken},
+		{description: "the owner claiming it again", identityId: alice, username: "Alice"},
+		{description: "a reserved name", identityId: bob, username: "root", wantErr: errUsernameReserved},
+		{description: "a name with spaces", identityId: bob, username: "bob smith", wantErr: errUsernameInvalid},
+	}
+	for _, step := range steps {
+		err := claimUsername(step.identityId, step.username)
+		if !errors.Is(err, step.wantErr) {
+			t.Errorf("error, for %s expected %v but got %v", step.description, step.wantErr, err)
+		}
+	}
+	if username, _ := fetchUsername(bob); username != "" {
+		t.Errorf("error, expected bob to be left without a name but got %q", username)
+	}
+}
+
+func Test_identifySession(t *testing.T) {
+	newTestDatabase(t)
+	key := newTestKey(t)
+	identity, err := identifySession("alice", key)
+	if err != nil || identity.username != "alice" {
+		t.Fatalf("error, expected connecting as a free name to claim it but got %+v (%v)", identity, err)
+	}
+	_, err = identifySession("alice", newTestKey(t))
+	var impersonation impersonationError
+	if !errors.As(err, &impersonation) {
+		t.Fatalf("error, expected an unlinked key to be turned away but got %v", err)
+	}
+	if !strings.Contains(err.Error(), "link code") {
+		t.Errorf("error, expected the owner's other keys to be pointed at linking but got %q", err.Error())
+	}
+	again, err := identifySession("alice", key)
+	if err != nil || again.id != identity.id {
+		t.Errorf("error, expected the owner to get back in but got %+v (%v)", again, err)
+	}
+}
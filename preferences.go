@@ -0,0 +1,77 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errorMode what happens when the player presses the wrong key
+type errorMode string
+
+const (
+	// errorModeCorrect the word the mistake was made in turns incorrect and has to be deleted before going on
+	errorModeCorrect errorMode = "correct"
+	// errorModeStop the wrong key is rejected and the cursor stays put
+	errorModeStop errorMode = "stop"
+	// errorModeFreeFlow the cursor moves on anyway, mistakes stay marked and count against accuracy
+	errorModeFreeFlow errorMode = "free"
+)
+
+var errorModes = []errorMode{errorModeCorrect, errorModeStop, errorModeFreeFlow}
+
+func (e errorMode) label() string {
+	switch e {
+	case errorModeStop:
+		return "stop on error"
+	case errorModeFreeFlow:
+		return "free flow"
+	}
+	return "correct mistakes"
+}
+
+// preferences how a player likes races to behave. They don't affect which lobby a player ends up in, so unlike race
+// options they can differ between racers in the same race.
+type preferences struct {
+	// confineErrorsToWord a mistake only marks the word it was made in as incorrect, trailing punctuation and spaces
+	// count as their own word, and the incorrect run stops growing at the end of the word
+	confineErrorsToWord bool
+	errorMode           errorMode
+}
+
+func defaultPreferences() preferences {
+	return preferences{errorMode: errorModeCorrect}
+}
+
+// fetchPreferences players that never saved any get the defaults
+func fetchPreferences(userFingerprint string) (preferences, error) {
+	p := defaultPreferences()
+	err := theClients.Database.Conn.QueryRow(
+		`SELECT confine_errors_to_word, error_mode FROM preference WHERE ssh_finger_print = ?`,
+		userFingerprint,
+	).Scan(&p.confineErrorsToWord, &p.errorMode)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return preferences{}, fmt.Errorf("error, when querying preference for fetchPreferences(). Error: %v", err)
+	}
+	return p, nil
+}
+
+func savePreferences(userFingerprint string, p preferences) error {
+	_, err := theClients.Database.Conn.Exec(
+		`INSERT INTO preference (ssh_finger_print, confine_errors_to_word, error_mode, updated_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (ssh_finger_print) DO UPDATE
+SET confine_errors_to_word = excluded.confine_errors_to_word,
+	error_mode = excluded.error_mode,
+	updated_at = excluded.updated_at`,
+		userFingerprint,
+		p.confineErrorsToWord,
+		string(p.errorMode),
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("error, when executing sql statement for savePreferences(). Error: %v", err)
+	}
+	return nil
+}
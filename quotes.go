@@ -0,0 +1,72 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+)
+
+const sentenceSourceBundled = "bundled"
+
+//go:embed quotes/quotes.json
+var bundledQuotes []byte
+
+// quote an entry in a quotes file
+type quote struct {
+	Text   string `json:"text"`
+	Author string `json:"author"`
+	Source string `json:"source"`
+	// Length optional character count, worked out from the text when left out
+	Length int `json:"length"`
+}
+
+func parseQuotes(data []byte) ([]quote, error) {
+	var quotes []quote
+	err := json.Unmarshal(data, &quotes)
+	if err != nil {
+		return nil, fmt.Errorf("error, when decoding quotes for parseQuotes(). Error: %v", err)
+	}
+	return quotes, nil
+}
+
+func quotesToSentenceRecords(quotes []quote, source string) []sentenceRecord {
+	records := make([]sentenceRecord, len(quotes))
+	for i, q := range quotes {
+		records[i] = sentenceRecord{
+			text:      filterOutWeirdText(q.Text),
+			source:    source,
+			kind:      sentenceKindQuote,
+			author:    filterOutWeirdText(q.Author),
+			work:      filterOutWeirdText(q.Source),
+			charCount: q.Length,
+		}
+	}
+	return records
+}
+
+// seedQuotes adds the quotes bundled with the binary to the sentence pool, quotes already in the pool are left alone
+func seedQuotes() error {
+	quotes, err := parseQuotes(bundledQuotes)
+	if err != nil {
+		return fmt.Errorf("error, when parseQuotes() for seedQuotes(). Error: %v", err)
+	}
+	err = persistSentenceRecords(quotesToSentenceRecords(quotes, sentenceSourceBundled))
+	if err != nil {
+		return fmt.Errorf("error, when persistSentenceRecords() for seedQuotes(). Error: %v", err)
+	}
+	return nil
+}
+
+// formatAttribution e.g. "- Mark Twain, attributed"
+func formatAttribution(author string, work string) string {
+	switch {
+	case author == "" && work == "":
+		return ""
+	case work == "":
+		return fmt.Sprintf("- %s", author)
+	case author == "":
+		return fmt.Sprintf("- %s", work)
+	default:
+		return fmt.Sprintf("- %s, %s", author, work)
+	}
+}
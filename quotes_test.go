@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func Test_parseQuotes(t *testing.T) {
+	t.Run("bundled quotes are valid", func(t *testing.T) {
+		quotes, err := parseQuotes(bundledQuotes)
+		if err != nil {
+			t.Fatalf("error, expected no error but got %v", err)
+		}
+		for _, q := range quotes {
+			if q.Text == "" || q.Author == "" {
+				t.Errorf("error, expected text and author for every quote but got %+v", q)
+			}
+		}
+	})
+}
+
+func Test_pickQuoteForLength(t *testing.T) {
+	t.Run("closest length out of the least seen", func(t *testing.T) {
+		candidates := []sentenceCandidate{
+			{id: 1, charCount: 100, seenCount: 1},
+			{id: 2, charCount: 300, seenCount: 0},
+			{id: 3, charCount: 150, seenCount: 0},
+		}
+		expected := int64(3)
+		got := pickQuoteForLength(candidates, 100)
+		if got.id != expected {
+			t.Errorf("error, expected quote %d but got %d", expected, got.id)
+		}
+	})
+}
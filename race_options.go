@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/JeremiahVaughan/terminaltype/config"
+)
+
+type raceMode string
+
+const (
+	raceModeSentences raceMode = "sentences"
+	raceModeCode      raceMode = "code"
+	raceModeQuote     raceMode = "quote"
+	raceModeWords     raceMode = "words"
+	raceModeCustom    raceMode = "custom words"
+	raceModeNumbers   raceMode = "numbers"
+	raceModeSymbols   raceMode = "symbols"
+	raceModeAdaptive  raceMode = "weak keys"
+)
+
+var raceModes = []raceMode{
+	raceModeSentences,
+	raceModeCode,
+	raceModeQuote,
+	raceModeWords,
+	raceModeCustom,
+	raceModeNumbers,
+	raceModeSymbols,
+	raceModeAdaptive,
+}
+
+type raceLength string
+
+const (
+	raceLengthShort  raceLength = "short"
+	raceLengthMedium raceLength = "medium"
+	raceLengthLong   raceLength = "long"
+)
+
+var raceLengths = []raceLength{raceLengthShort, raceLengthMedium, raceLengthLong}
+
+// targetCharCount races are filled with text until they reach at least this many characters
+func (l raceLength) targetCharCount() int {
+	switch l {
+	case raceLengthShort:
+		return 120
+	case raceLengthLong:
+		return 480
+	default:
+		return 240
+	}
+}
+
+type raceDifficulty string
+
+const (
+	raceDifficultyEasy   raceDifficulty = "easy"
+	raceDifficultyNormal raceDifficulty = "normal"
+	raceDifficultyHard   raceDifficulty = "hard"
+)
+
+var raceDifficulties = []raceDifficulty{raceDifficultyEasy, raceDifficultyNormal, raceDifficultyHard}
+
+// tier the sentence pool is split into thirds by difficulty score, this is the third the difficulty draws from
+func (d raceDifficulty) tier() int {
+	switch d {
+	case raceDifficultyEasy:
+		return 1
+	case raceDifficultyHard:
+		return 3
+	default:
+		return 2
+	}
+}
+
+// raceTimeLimit in seconds, timed races end when time runs out rather than when the text runs out
+type raceTimeLimit int
+
+const raceTimeLimitOff raceTimeLimit = 0
+
+// raceTimeLimits the last one is the longest, config checks that races are allowed to run that long
+var raceTimeLimits = []raceTimeLimit{raceTimeLimitOff, 15, 30, 60, config.LongestTimedRaceInSeconds}
+
+func (t raceTimeLimit) duration() time.Duration {
+	return time.Duration(t) * time.Second
+}
+
+func (t raceTimeLimit) String() string {
+	if t == raceTimeLimitOff {
+		return "off"
+	}
+	return fmt.Sprintf("%ds", t)
+}
+
+// raceOptions what the player picked on the welcome screen, players only race others who picked the same options
+type raceOptions struct {
+	Mode       raceMode       `json:"mode"`
+	Length     raceLength     `json:"length"`
+	Difficulty raceDifficulty `json:"difficulty"`
+	TimeLimit  raceTimeLimit  `json:"timeLimit"`
+}
+
+func defaultRaceOptions() raceOptions {
+	return raceOptions{
+		Mode:       raceModeSentences,
+		Length:     raceLengthMedium,
+		Difficulty: raceDifficultyNormal,
+	}
+}
+
+// normalize replaces anything unrecognized with the default so a bad request can't create a lobby nobody else can join
+func (o raceOptions) normalize() raceOptions {
+	d := defaultRaceOptions()
+	if !contains(raceModes, o.Mode) {
+		o.Mode = d.Mode
+	}
+	if !contains(raceLengths, o.Length) {
+		o.Length = d.Length
+	}
+	if !contains(raceDifficulties, o.Difficulty) {
+		o.Difficulty = d.Difficulty
+	}
+	if !contains(raceTimeLimits, o.TimeLimit) || !isDrillMode(o.Mode) {
+		o.TimeLimit = raceTimeLimitOff
+	}
+	// options that don't apply go back to their defaults so they don't split up lobbies for no reason
+	if o.Mode != raceModeSentences && o.Mode != raceModeQuote {
+		o.Difficulty = d.Difficulty
+	}
+	if o.timed() {
+		o.Length = d.Length
+	}
+	return o
+}
+
+func (o raceOptions) timed() bool {
+	return o.TimeLimit != raceTimeLimitOff
+}
+
+// lobbyKey custom word lists and weak keys are the player's own, so those lobbies only ever hold that player
+func (o raceOptions) lobbyKey(fingerprint string) string {
+	key := fmt.Sprintf("%s:%s:%s:%s", o.Mode, o.Length, o.Difficulty, o.TimeLimit)
+	if o.Mode == raceModeCustom || o.Mode == raceModeAdaptive {
+		key += ":" + fingerprint
+	}
+	return key
+}
+
+type raceOptionRow struct {
+	label string
+	value func(o raceOptions) string
+	cycle func(o raceOptions, step int) raceOptions
+	// appliesTo nil when the option applies to every mode
+	appliesTo func(o raceOptions) bool
+}
+
+var raceOptionRows = []raceOptionRow{
+	{
+		label: "mode",
+		value: func(o raceOptions) string { return string(o.Mode) },
+		cycle: func(o raceOptions, step int) raceOptions {
+			o.Mode = cycleValue(raceModes, o.Mode, step)
+			return o
+		},
+	},
+	{
+		label: "length",
+		value: func(o raceOptions) string { return string(o.Length) },
+		cycle: func(o raceOptions, step int) raceOptions {
+			o.Length = cycleValue(raceLengths, o.Length, step)
+			return o
+		},
+		appliesTo: func(o raceOptions) bool {
+			return !o.normalize().timed()
+		},
+	},
+	{
+		label: "difficulty",
+		value: func(o raceOptions) string { return string(o.Difficulty) },
+		cycle: func(o raceOptions, step int) raceOptions {
+			o.Difficulty = cycleValue(raceDifficulties, o.Difficulty, step)
+			return o
+		},
+		appliesTo: func(o raceOptions) bool {
+			return o.Mode == raceModeSentences || o.Mode == raceModeQuote
+		},
+	},
+	{
+		label: "time",
+		value: func(o raceOptions) string { return o.TimeLimit.String() },
+		cycle: func(o raceOptions, step int) raceOptions {
+			o.TimeLimit = cycleValue(raceTimeLimits, o.TimeLimit, step)
+			return o
+		},
+		appliesTo: func(o raceOptions) bool {
+			return isDrillMode(o.Mode)
+		},
+	},
+}
+
+func renderRaceOptions(o raceOptions, selectedRow int) string {
+	b := strings.Builder{}
+	for i, row := range raceOptionRows {
+		pointer := " "
+		if i == selectedRow {
+			pointer = ">"
+		}
+		value := row.value(o)
+		if row.appliesTo != nil && !row.appliesTo(o) {
+			value = "n/a"
+		}
+		b.WriteString(fmt.Sprintf("%s %-12s< %s >\n", pointer, row.label, value))
+	}
+	b.WriteString("\n(UP/DOWN TO PICK AN OPTION, LEFT/RIGHT TO CHANGE IT)")
+	if o.Mode == raceModeCustom {
+		b.WriteString("\n(E TO EDIT YOUR CUSTOM WORD LIST)")
+	}
+	b.WriteString("\n(P TO SEE YOUR WEAK KEYS, A FOR YOUR ACCOUNT, R TO WATCH REPLAYS)")
+	return b.String()
+}
+
+// cycleValue moves step places through values wrapping around at either end
+func cycleValue[T comparable](values []T, current T, step int) T {
+	i := 0
+	for j, v := range values {
+		if v == current {
+			i = j
+			break
+		}
+	}
+	i = (i + step) % len(values)
+	if i < 0 {
+		i += len(values)
+	}
+	return values[i]
+}
+
+// isWhitespace the race text is held as a slice of single character strings, this is the check for one of those
+func isWhitespace(char string) bool {
+	return char == " " || char == "\t" || char == "\n"
+}
+
+// isIndentation whitespace that auto-indent types for the player after a newline
+func isIndentation(char string) bool {
+	return char == " " || char == "\t"
+}
+
+func rowIndexes(size int) []int {
+	result := make([]int, size)
+	for i := range result {
+		result[i] = i
+	}
+	return result
+}
+
+func contains[T comparable](values []T, target T) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
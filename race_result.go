@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// raceResult how one racer did in one race. Races the player didn't finish are kept with however far they got.
+type raceResult struct {
+	raceId             string
+	mode               raceMode
+	errorMode          errorMode
+	wordsPerMin        int
+	accuracy           float64
+	percentageComplete float32
+	didNotFinish       bool
+	finishedAt         time.Time
+	// text and replayEvents are kept as the race's replay
+	text         string
+	replayEvents []replayEvent
+}
+
+func recordRaceResult(userFingerprint string, r raceResult) error {
+	tx, err := theClients.Database.Conn.Begin()
+	if err != nil {
+		return fmt.Errorf("error, when beginning transaction for recordRaceResult(). Error: %v", err)
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec(
+		`INSERT INTO race_result (ssh_finger_print, race_id, mode, error_mode, words_per_min, accuracy, percentage_complete, did_not_finish, finished_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		userFingerprint,
+		r.raceId,
+		string(r.mode),
+		string(r.errorMode),
+		r.wordsPerMin,
+		r.accuracy,
+		r.percentageComplete,
+		r.didNotFinish,
+		r.finishedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("error, when inserting race result for recordRaceResult(). Error: %v", err)
+	}
+	// a race left before a key was pressed has nothing to watch
+	if len(r.replayEvents) > 0 {
+		raceResultId, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("error, when getting race result id for recordRaceResult(). Error: %v", err)
+		}
+		events, err := json.Marshal(r.replayEvents)
+		if err != nil {
+			return fmt.Errorf("error, when encoding replay events for recordRaceResult(). Error: %v", err)
+		}
+		_, err = tx.Exec(
+			`INSERT INTO race_replay (race_result_id, text, events) VALUES (?, ?, ?)`,
+			raceResultId,
+			r.text,
+			string(events),
+		)
+		if err != nil {
+			return fmt.Errorf("error, when inserting race replay for recordRaceResult(). Error: %v", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error, when committing transaction for recordRaceResult(). Error: %v", err)
+	}
+	return nil
+}
+
+// currentRaceResult the result of the race in progress as if it ended now, the standard five characters to a word
+// is used for a race that ended part way through the text
+func currentRaceResult(m model, didNotFinish bool, now time.Time) raceResult {
+	wordsTyped := m.data.wordCount
+	if didNotFinish || m.data.options.timed() {
+		wordsTyped = m.correctPos / 5
+	}
+	return raceResult{
+		raceId:             m.data.raceId,
+		mode:               m.data.options.Mode,
+		errorMode:          m.preferences.errorMode,
+		wordsPerMin:        calculateWordsPerMin(m.raceStartTime, now.UnixMilli(), wordsTyped),
+		accuracy:           raceAccuracy(m.keyStats),
+		percentageComplete: raceProgressPercentage(m),
+		didNotFinish:       didNotFinish,
+		finishedAt:         now,
+		text:               strings.Join(m.raceWordsCharSlice, ""),
+		replayEvents:       m.replayEvents,
+	}
+}
+
+// raceAccuracy the share of keys pressed that were the right key, 1 when nothing was typed
+func raceAccuracy(stats map[keyStatKey]*keyStat) float64 {
+	var attempts, errors int
+	for k, s := range stats {
+		if k.kind != keyStatKindChar {
+			continue
+		}
+		attempts += s.attempts
+		errors += s.errors
+	}
+	if attempts == 0 {
+		return 1
+	}
+	return float64(attempts-errors) / float64(attempts)
+}
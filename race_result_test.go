@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_currentRaceResult(t *testing.T) {
+	start := time.Unix(1000, 0)
+	m := model{
+		raceWordsCharSlice: strings.Split("the quick brown fox jumps", ""),
+		raceStartTime:      start.UnixMilli(),
+		data:               modelData{raceId: "a", wordCount: 5, options: raceOptions{Mode: raceModeSentences}},
+	}
+	t.Run("finished", func(t *testing.T) {
+		m.correctPos = len(m.raceWordsCharSlice)
+		got := currentRaceResult(m, false, start.Add(time.Minute))
+		if got.wordsPerMin != 5 || got.percentageComplete != 1 || got.didNotFinish {
+			t.Errorf("error, expected 5 wpm finished but got %+v", got)
+		}
+	})
+	t.Run("did not finish keeps how far the racer got", func(t *testing.T) {
+		m.correctPos = 10
+		got := currentRaceResult(m, true, start.Add(time.Minute))
+		if got.wordsPerMin != 2 || got.percentageComplete != 0.4 || !got.didNotFinish {
+			t.Errorf("error, expected 2 wpm not finished at 40%% but got %+v", got)
+		}
+	})
+}
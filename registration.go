@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/stopwatch"
+	"github.com/charmbracelet/bubbles/timer"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/nats-io/nats.go"
+)
+
+// raceRegisteredMsg the player has a spot in a lobby, the race starts at the response's start time unless the lobby fills first
+type raceRegisteredMsg struct {
+	registrationId int
+	response       RegResponse
+}
+
+// raceStartedMsg the lobby closed and the race is ready
+type raceStartedMsg struct {
+	registrationId int
+	registration   RaceRegistration
+}
+
+var errRaceSetupFailed = errors.New("the race couldn't be set up, try again")
+
+type registrationFailedMsg struct {
+	registrationId int
+	err            error
+}
+
+// registerForRace asks for a spot in a lobby. The answers come back as messages tagged with the registration id, so
+// anything still on its way after the player has left the lobby can be told apart and ignored.
+func registerForRace(m model) (model, tea.Cmd) {
+	var err error
+	if m.natsConnection == nil {
+		m.natsConnection, err = connectToNats()
+		if err != nil {
+			m.data.err = fmt.Errorf("error, when connectToNats() for registerForRace(). Error: %v", err)
+			HandleUnexpectedError(nil, m.data.err)
+			return m, nil
+		}
+		if m.session != nil {
+			m.session.setNatsConnection(m.natsConnection)
+		}
+	}
+	m.settings = runtimeSettings()
+	sub, err := m.natsConnection.SubscribeSync(m.fingerprint)
+	if err != nil {
+		m.data.err = fmt.Errorf("error, when subscribing to registration queue for registerForRace(). Error: %v", err)
+		HandleUnexpectedError(nil, m.data.err)
+		return m, nil
+	}
+	regRequest, err := json.Marshal(RegRequest{
+		Fingerprint: m.fingerprint,
+		Username:    m.username,
+		Options:     m.raceOptions,
+	})
+	if err != nil {
+		sub.Unsubscribe()
+		m.data.err = fmt.Errorf("error, when encoding registration request for registerForRace(). Error: %v", err)
+		HandleUnexpectedError(nil, m.data.err)
+		return m, nil
+	}
+	err = m.natsConnection.Publish(raceRegistrationRequestQueueId, regRequest)
+	if err != nil {
+		sub.Unsubscribe()
+		m.data.err = fmt.Errorf("error, when publishing registation request message for registerForRace(). Error: %v", err)
+		HandleUnexpectedError(nil, m.data.err)
+		return m, nil
+	}
+	m.registrationId++
+	m.registration = sub
+	m.loading = true
+	// todo figure out the correct way to determine this channels buffer size
+	m.allRacerProgressChan = make(chan *nats.Msg, 30)
+	m.raceCtx, m.raceCancel = context.WithCancel(m.ctx)
+	return m, tea.Batch(
+		m.spinner.Tick,
+		awaitRegistrationResponse(m.registrationId, sub, registrationTimeout(m.settings)),
+	)
+}
+
+// registrationTimeout waits for twice as long as the race start timeout and then assumes failure
+func registrationTimeout(s *settings) time.Duration {
+	return time.Duration(s.raceStartTimeoutInSeconds) * 2 * time.Second
+}
+
+func awaitRegistrationResponse(registrationId int, sub *nats.Subscription, timeout time.Duration) tea.Cmd {
+	return func() tea.Msg {
+		subMsg, err := sub.NextMsg(timeout)
+		if err != nil {
+			return registrationFailedMsg{
+				registrationId: registrationId,
+				err:            fmt.Errorf("error, when recieving race registration start time for awaitRegistrationResponse(). Error: %v", err),
+			}
+		}
+		var response RegResponse
+		err = json.Unmarshal(subMsg.Data, &response)
+		if err != nil {
+			return registrationFailedMsg{
+				registrationId: registrationId,
+				err:            fmt.Errorf("error, when decoding RegResponse for awaitRegistrationResponse(). Error: %v", err),
+			}
+		}
+		return raceRegisteredMsg{registrationId: registrationId, response: response}
+	}
+}
+
+func awaitRaceStart(registrationId int, sub *nats.Subscription, timeout time.Duration) tea.Cmd {
+	return func() tea.Msg {
+		subMsg, err := sub.NextMsg(timeout)
+		if err != nil {
+			return registrationFailedMsg{
+				registrationId: registrationId,
+				err:            fmt.Errorf("error, when retrieving registration response message for awaitRaceStart(). Error: %v", err),
+			}
+		}
+		reg, err := decodeRaceRegistration(subMsg.Data)
+		if err != nil {
+			return registrationFailedMsg{
+				registrationId: registrationId,
+				err:            fmt.Errorf("error, when decoding registration response message for awaitRaceStart(). Error: %v", err),
+			}
+		}
+		return raceStartedMsg{registrationId: registrationId, registration: reg}
+	}
+}
+
+// currentRegistration whether a registration message is for the lobby the player is still waiting in
+func currentRegistration(m model, registrationId int) bool {
+	return m.loading && m.registration != nil && registrationId == m.registrationId
+}
+
+func handleRaceRegistered(m model, msg raceRegisteredMsg) (model, tea.Cmd) {
+	if !currentRegistration(m, msg.registrationId) {
+		return m, nil
+	}
+	timeRemainingTillStart := msg.response.RaceStartTime - time.Now().Unix()
+	m.raceStartCountDown = timer.NewWithInterval(time.Duration(timeRemainingTillStart)*time.Second, time.Second)
+	m.data.raceId = msg.response.RaceId
+	return m, tea.Batch(
+		m.raceStartCountDown.Init(),
+		awaitRaceStart(msg.registrationId, m.registration, registrationTimeout(m.settings)),
+	)
+}
+
+func handleRegistrationFailed(m model, msg registrationFailedMsg) (model, tea.Cmd) {
+	if !currentRegistration(m, msg.registrationId) {
+		return m, nil
+	}
+	m = leaveLobby(m)
+	m.data.err = msg.err
+	HandleUnexpectedError(nil, m.data.err)
+	return m, nil
+}
+
+// cancelRegistration lets the lobby know the player left so their slot can go to someone else
+func cancelRegistration(m model) model {
+	leave, err := json.Marshal(RegRequest{
+		Fingerprint: m.fingerprint,
+		Options:     m.raceOptions,
+		Leave:       true,
+	})
+	if err == nil {
+		err = m.natsConnection.Publish(raceRegistrationRequestQueueId, leave)
+	}
+	if err != nil {
+		// the slot stays taken until the race starts, the player can still leave
+		HandleUnexpectedError(nil, fmt.Errorf("error, when publishing leave request for cancelRegistration(). Error: %v", err))
+	}
+	return leaveLobby(m)
+}
+
+// leaveLobby stops waiting on the lobby, whatever it still sends is ignored
+func leaveLobby(m model) model {
+	if m.registration != nil {
+		err := m.registration.Unsubscribe()
+		if err != nil {
+			HandleUnexpectedError(nil, fmt.Errorf("error, when unsubscribing from registration for leaveLobby(). Error: %v", err))
+		}
+		m.registration = nil
+	}
+	if m.raceCancel != nil {
+		m.raceCancel()
+	}
+	m.loading = false
+	m.resetSpinner()
+	return m
+}
+
+func handleRaceStarted(m model, msg raceStartedMsg) (model, tea.Cmd) {
+	if !currentRegistration(m, msg.registrationId) {
+		return m, nil
+	}
+	if msg.registration.Error != "" {
+		// the server has already reported what went wrong
+		m = leaveLobby(m)
+		m.data.err = errors.New(msg.registration.Error)
+		return m, nil
+	}
+	err := m.registration.Unsubscribe()
+	if err != nil {
+		HandleUnexpectedError(nil, fmt.Errorf("error, when unsubscribing from registration for handleRaceStarted(). Error: %v", err))
+	}
+	m.registration = nil
+	m.loading = false
+	m.resetSpinner()
+
+	reg := msg.registration
+	m.data.raceId = reg.RaceId
+	m.data.options = reg.Options
+	m.data.attribution = reg.Attribution
+	m.data.seed = reg.Seed
+	m.data.drillChunks = reg.DrillChunks
+	m.data.wordList = reg.WordList
+	m.data.raceWords = reg.RaceWords
+	m.data.wordCount = reg.WordCount
+	m.data.allRacerProgress = reg.AllRaceProgress
+	m.data.racerCount = reg.RacerCount
+	m.raceStartTime = reg.GoTime
+	goTime := time.UnixMilli(reg.GoTime)
+	go monitorRaceProgression(
+		m.raceCtx,
+		m.natsConnection,
+		m.data.raceId,
+		m.allRacerProgressChan,
+		m.raceCancel,
+		time.Until(goTime)+m.settings.raceTimeout,
+	)
+
+	m.activeView = activeViewRace
+	m.raceWordsCharSlice = strings.Split(m.data.raceWords, "")
+	m.correctPos = 0
+	m.incorrectPos = 0
+	m.mistakes = nil
+	m.keyStats = make(map[keyStatKey]*keyStat)
+	m.replayEvents = nil
+	m.lastKeyAt = time.Time{}
+	// the countdown doesn't count towards being idle
+	m.lastInputAt = goTime
+	m.dnfReason = ""
+	m.racerProgressBars = make([]progress.Model, len(m.data.allRacerProgress))
+	for i := int8(0); i < m.data.racerCount; i++ {
+		m.racerProgressBars[i] = progress.New(progress.WithSolidFill(m.settings.playerColor(i)))
+		if m.fingerprint == m.data.allRacerProgress[i].Fingerprint {
+			m.racerId = i
+		}
+	}
+	return m, countDown(m.raceStartTime)
+}
+
+// raceCountdown how long racers get to read the first few words between the lobby closing and typing starting
+const raceCountdown = 3 * time.Second
+
+// raceCountdownMsg sent on every whole second of the countdown and once more at GO
+type raceCountdownMsg struct {
+	raceStartTime int64
+}
+
+// countDown ticks on the whole seconds before GO, so every racer's countdown changes at the same moment
+func countDown(raceStartTime int64) tea.Cmd {
+	return tea.Tick(countDownTick(time.Until(time.UnixMilli(raceStartTime))), func(time.Time) tea.Msg {
+		return raceCountdownMsg{raceStartTime: raceStartTime}
+	})
+}
+
+// countDownTick how long until the countdown shows its next whole second, or GO once untilGo has passed
+func countDownTick(untilGo time.Duration) time.Duration {
+	if untilGo <= 0 {
+		return 0
+	}
+	next := untilGo % time.Second
+	if next == 0 {
+		next = time.Second
+	}
+	return next
+}
+
+// raceUnderway typing is locked until GO
+func raceUnderway(m model, now time.Time) bool {
+	return m.activeView == activeViewRace && now.UnixMilli() >= m.raceStartTime
+}
+
+func handleRaceCountdown(m model, msg raceCountdownMsg) (model, tea.Cmd) {
+	if m.activeView != activeViewRace || msg.raceStartTime != m.raceStartTime {
+		return m, nil
+	}
+	if !raceUnderway(m, time.Now()) {
+		return m, countDown(m.raceStartTime)
+	}
+	return startRaceClock(m)
+}
+
+// startRaceClock starts everything that is timed from GO
+func startRaceClock(m model) (model, tea.Cmd) {
+	var cmd tea.Cmd
+	if m.raceTicker == nil {
+		newWatch := stopwatch.New()
+		m.raceTicker = &newWatch
+		cmd = m.raceTicker.Init()
+	} else {
+		cmd = m.raceTicker.Start()
+	}
+	// raceStartTime rather than the race id tells races apart since the race id is reused by whoever is in the first slot
+	raceStartTime := m.raceStartTime
+	if m.data.options.timed() {
+		timeUpCmd := tea.Tick(m.data.options.TimeLimit.duration(), func(time.Time) tea.Msg {
+			return raceTimeUpMsg{raceStartTime: raceStartTime}
+		})
+		cmd = tea.Batch(cmd, timeUpCmd)
+	}
+	timedOutCmd := tea.Tick(m.settings.raceTimeout, func(time.Time) tea.Msg {
+		return raceTimedOutMsg{raceStartTime: raceStartTime}
+	})
+	cmd = tea.Batch(cmd, timedOutCmd)
+	return m, cmd
+}
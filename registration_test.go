@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func Test_currentRegistration(t *testing.T) {
+	waiting := model{loading: true, registration: &nats.Subscription{}, registrationId: 2}
+	tests := []struct {
+		name           string
+		m              model
+		registrationId int
+		want           bool
+	}{
+		{name: "the lobby being waited on", m: waiting, registrationId: 2, want: true},
+		{name: "a lobby the player already left", m: waiting, registrationId: 1, want: false},
+		{name: "not waiting on a lobby", m: model{registrationId: 2}, registrationId: 2, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := currentRegistration(tt.m, tt.registrationId)
+			if got != tt.want {
+				t.Errorf("error, expected %v but got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_handleRegistrationFailed(t *testing.T) {
+	t.Run("failures from a lobby the player already left are ignored", func(t *testing.T) {
+		m := model{loading: true, registration: &nats.Subscription{}, registrationId: 2}
+		got, _ := handleRegistrationFailed(m, registrationFailedMsg{registrationId: 1, err: errors.New("timeout")})
+		if !got.loading || got.data.err != nil {
+			t.Errorf("error, expected the player to still be waiting on the lobby without an error")
+		}
+	})
+}
+
+func Test_RaceRegistration_removeRacer(t *testing.T) {
+	t.Run("racers after the one leaving move up", func(t *testing.T) {
+		rr := RaceRegistration{
+			RaceId:     "a",
+			RacerCount: 3,
+			AllRaceProgress: []RaceProgress{
+				{RacerId: 0, Fingerprint: "a", Username: "alice"},
+				{RacerId: 1, Fingerprint: "b"},
+				{RacerId: 2, Fingerprint: "c", Username: "carol"},
+				{},
+			},
+		}
+		if !rr.removeRacer("a") {
+			t.Fatalf("error, expected alice to be removed")
+		}
+		want := []RaceProgress{
+			{RacerId: 0, Fingerprint: "b"},
+			{RacerId: 1, Fingerprint: "c", Username: "carol"},
+			{},
+			{},
+		}
+		if rr.RacerCount != 2 || rr.RaceId != "b" {
+			t.Errorf("error, expected 2 racers in race b but got %d in race %s", rr.RacerCount, rr.RaceId)
+		}
+		for i := range want {
+			if rr.AllRaceProgress[i] != want[i] {
+				t.Errorf("error, expected slot %d to be %+v but got %+v", i, want[i], rr.AllRaceProgress[i])
+			}
+		}
+	})
+	t.Run("racers not in the lobby", func(t *testing.T) {
+		rr := RaceRegistration{RacerCount: 1, AllRaceProgress: []RaceProgress{{Fingerprint: "a"}, {}}}
+		if rr.removeRacer("z") || rr.RacerCount != 1 {
+			t.Errorf("error, expected nothing to change")
+		}
+	})
+}
+
+func Test_countdownLabel(t *testing.T) {
+	goTime := time.Unix(1000, 0)
+	m := model{activeView: activeViewRace, raceStartTime: goTime.UnixMilli()}
+	tests := []struct {
+		now  time.Time
+		want string
+	}{
+		{now: goTime.Add(-3 * time.Second), want: "3"},
+		{now: goTime.Add(-2500 * time.Millisecond), want: "3"},
+		{now: goTime.Add(-time.Second), want: "1"},
+		{now: goTime.Add(-time.Millisecond), want: "1"},
+		{now: goTime, want: "GO!"},
+		{now: goTime.Add(time.Second), want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.now.Sub(goTime).String(), func(t *testing.T) {
+			got := countdownLabel(m, tt.now)
+			if got != tt.want {
+				t.Errorf("error, expected %q but got %q", tt.want, got)
+			}
+			if underway := raceUnderway(m, tt.now); underway != !tt.now.Before(goTime) {
+				t.Errorf("error, expected typing to be locked only before GO")
+			}
+		})
+	}
+}
+
+func Test_countDownTick(t *testing.T) {
+	tests := []struct {
+		name    string
+		untilGo time.Duration
+		want    time.Duration
+	}{
+		{name: "part way through a second", untilGo: 2300 * time.Millisecond, want: 300 * time.Millisecond},
+		{name: "exactly on a second still shows the next one", untilGo: 3 * time.Second, want: time.Second},
+		{name: "the last second", untilGo: time.Second, want: time.Second},
+		{name: "GO already", untilGo: 0, want: 0},
+		{name: "late", untilGo: -time.Second, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := countDownTick(tt.untilGo)
+			if got != tt.want {
+				t.Errorf("error, expected %v but got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_Update_staleRaceTimeUp(t *testing.T) {
+	// the first racer's fingerprint is the race id, so the next race they start has the same one
+	first := time.Unix(1000, 0).UnixMilli()
+	m := model{
+		activeView:         activeViewRace,
+		raceStartTime:      time.Unix(1200, 0).UnixMilli(),
+		raceWordsCharSlice: strings.Split("hello", ""),
+		settings:           runtimeSettings(),
+	}
+	m.data.raceId = "alice"
+	updated, _ := m.Update(raceTimeUpMsg{raceStartTime: first})
+	if updated.(model).activeView != activeViewRace {
+		t.Errorf("error, expected the time limit of an earlier race to leave this one running")
+	}
+}
+
+func Test_handleRaceStarted_setupFailed(t *testing.T) {
+	if ns == nil {
+		err := initNats()
+		if err != nil {
+			t.Fatalf("error, when initNats(): %v", err)
+		}
+	}
+	conn, err := connectToNats()
+	if err != nil {
+		t.Fatalf("error, unexpected error: %v", err)
+	}
+	defer conn.Close()
+	sub, err := conn.SubscribeSync("racer")
+	if err != nil {
+		t.Fatalf("error, unexpected error: %v", err)
+	}
+	m := model{loading: true, registration: sub, registrationId: 1, activeView: activeViewWelcome}
+	got, _ := handleRaceStarted(m, raceStartedMsg{
+		registrationId: 1,
+		registration:   RaceRegistration{RaceId: "racer", Error: errRaceSetupFailed.Error()},
+	})
+	if got.activeView == activeViewRace || got.loading || got.registration != nil {
+		t.Errorf("error, expected the player to be out of the lobby rather than racing an empty text")
+	}
+	if got.data.err == nil || got.data.err.Error() != errRaceSetupFailed.Error() {
+		t.Errorf("error, expected the player to be told the race failed but got %v", got.data.err)
+	}
+}
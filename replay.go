@@ -0,0 +1,425 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// replayEvent a key pressed during a race and where it left the cursor, at is milliseconds after GO
+type replayEvent struct {
+	At           int64  `json:"at"`
+	Key          string `json:"key"`
+	CorrectPos   int    `json:"correctPos"`
+	IncorrectPos int    `json:"incorrectPos"`
+}
+
+func recordReplayEvent(m model, key string, now time.Time) model {
+	m.replayEvents = append(m.replayEvents, replayEvent{
+		At:           now.UnixMilli() - m.raceStartTime,
+		Key:          key,
+		CorrectPos:   m.correctPos,
+		IncorrectPos: m.incorrectPos,
+	})
+	return m
+}
+
+var errReplayNotFound = errors.New("there is no replay with that id")
+
+// replaySummary one race there is a replay of
+type replaySummary struct {
+	raceResultId int64
+	owner        string // the identity of whoever ran the race
+	username     string // empty for guests and players who haven't claimed one
+	mode         raceMode
+	errorMode    errorMode
+	wordsPerMin  int
+	accuracy     float64
+	didNotFinish bool
+	finishedAt   time.Time
+}
+
+type replay struct {
+	replaySummary
+	text   string
+	events []replayEvent
+}
+
+// duration how long the race took up to the last key pressed
+func (r replay) duration() time.Duration {
+	if len(r.events) == 0 {
+		return 0
+	}
+	return time.Duration(r.events[len(r.events)-1].At) * time.Millisecond
+}
+
+const replaySummaryColumns = `r.id, r.ssh_finger_print, COALESCE(p.username, ''), r.mode, r.error_mode, r.words_per_min, r.accuracy, r.did_not_finish, r.finished_at`
+
+const replaySummaryJoins = `FROM race_result r
+JOIN race_replay rp ON rp.race_result_id = r.id
+LEFT JOIN player p ON p.identity_id = r.ssh_finger_print`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanReplaySummary(row rowScanner, extra ...any) (replaySummary, error) {
+	var s replaySummary
+	var mode, errMode string
+	var finishedAt int64
+	err := row.Scan(append([]any{
+		&s.raceResultId,
+		&s.owner,
+		&s.username,
+		&mode,
+		&errMode,
+		&s.wordsPerMin,
+		&s.accuracy,
+		&s.didNotFinish,
+		&finishedAt,
+	}, extra...)...)
+	if err != nil {
+		return replaySummary{}, err
+	}
+	s.mode = raceMode(mode)
+	s.errorMode = errorMode(errMode)
+	s.finishedAt = time.Unix(finishedAt, 0)
+	return s, nil
+}
+
+// fetchReplaySummaries every race the player has a replay of, newest first
+func fetchReplaySummaries(userFingerprint string) ([]replaySummary, error) {
+	rows, err := theClients.Database.Conn.Query(
+		fmt.Sprintf(`SELECT %s
+%s
+WHERE r.ssh_finger_print = ?
+ORDER BY r.finished_at DESC, r.id DESC`, replaySummaryColumns, replaySummaryJoins),
+		userFingerprint,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error, when querying replays for fetchReplaySummaries(). Error: %v", err)
+	}
+	defer rows.Close()
+	var result []replaySummary
+	for rows.Next() {
+		s, err := scanReplaySummary(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error, when scanning replays for fetchReplaySummaries(). Error: %v", err)
+		}
+		result = append(result, s)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error, when reading replays for fetchReplaySummaries(). Error: %v", err)
+	}
+	return result, nil
+}
+
+// fetchRecordReplay the fastest finished race in mode, nil when nobody has finished one yet
+func fetchRecordReplay(mode raceMode) (*replaySummary, error) {
+	s, err := scanReplaySummary(theClients.Database.Conn.QueryRow(
+		fmt.Sprintf(`SELECT %s
+%s
+WHERE r.mode = ? AND r.did_not_finish = 0
+ORDER BY r.words_per_min DESC, r.finished_at ASC
+LIMIT 1`, replaySummaryColumns, replaySummaryJoins),
+		string(mode),
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error, when querying record replay for fetchRecordReplay(). Error: %v", err)
+	}
+	return &s, nil
+}
+
+// fetchReplay errReplayNotFound when the race has no replay
+func fetchReplay(raceResultId int64) (replay, error) {
+	var r replay
+	var events string
+	s, err := scanReplaySummary(theClients.Database.Conn.QueryRow(
+		fmt.Sprintf(`SELECT %s, rp.text, rp.events
+%s
+WHERE r.id = ?`, replaySummaryColumns, replaySummaryJoins),
+		raceResultId,
+	), &r.text, &events)
+	if errors.Is(err, sql.ErrNoRows) {
+		return replay{}, errReplayNotFound
+	}
+	if err != nil {
+		return replay{}, fmt.Errorf("error, when querying replay for fetchReplay(). Error: %v", err)
+	}
+	r.replaySummary = s
+	err = json.Unmarshal([]byte(events), &r.events)
+	if err != nil {
+		return replay{}, fmt.Errorf("error, when decoding replay events for fetchReplay(). Error: %v", err)
+	}
+	return r, nil
+}
+
+// replayFile what a replay is exported as
+type replayFile struct {
+	Id           int64         `json:"id"`
+	Username     string        `json:"username,omitempty"`
+	Mode         string        `json:"mode"`
+	ErrorMode    string        `json:"errorMode"`
+	WordsPerMin  int           `json:"wordsPerMin"`
+	Accuracy     float64       `json:"accuracy"`
+	DidNotFinish bool          `json:"didNotFinish"`
+	FinishedAt   time.Time     `json:"finishedAt"`
+	Text         string        `json:"text"`
+	Events       []replayEvent `json:"events"`
+}
+
+func encodeReplayFile(r replay) ([]byte, error) {
+	return json.MarshalIndent(replayFile{
+		Id:           r.raceResultId,
+		Username:     r.username,
+		Mode:         string(r.mode),
+		ErrorMode:    string(r.errorMode),
+		WordsPerMin:  r.wordsPerMin,
+		Accuracy:     r.accuracy,
+		DidNotFinish: r.didNotFinish,
+		FinishedAt:   r.finishedAt.UTC(),
+		Text:         r.text,
+		Events:       r.events,
+	}, "", "  ")
+}
+
+// replayPosition where the cursor was elapsed into the race. Free flow mistakes aren't stored, they are the keys
+// that moved the cursor on without matching the text.
+func replayPosition(r replay, elapsed time.Duration) (correctPos int, incorrectPos int, mistakes map[int]bool) {
+	chars := strings.Split(r.text, "")
+	for _, e := range r.events {
+		if time.Duration(e.At)*time.Millisecond > elapsed {
+			break
+		}
+		for pos := range mistakes {
+			if pos >= e.IncorrectPos {
+				delete(mistakes, pos)
+			}
+		}
+		if r.errorMode == errorModeFreeFlow && e.CorrectPos == correctPos+1 && correctPos < len(chars) && e.Key != chars[correctPos] {
+			if mistakes == nil {
+				mistakes = make(map[int]bool)
+			}
+			mistakes[correctPos] = true
+		}
+		correctPos = e.CorrectPos
+		incorrectPos = e.IncorrectPos
+	}
+	return correctPos, incorrectPos, mistakes
+}
+
+// replayListRows how many races are listed at once, the list scrolls to show the rest
+const replayListRows = 10
+
+// replayFrameInterval how often a playing replay is redrawn
+const replayFrameInterval = 50 * time.Millisecond
+
+// replayFrameMsg tagged with the playback it belongs to so restarting a replay doesn't leave two of them ticking
+type replayFrameMsg struct {
+	playbackId int
+	at         time.Time
+}
+
+type replayState struct {
+	record     *replaySummary // the fastest finished race in the mode picked on the welcome screen
+	list       []replaySummary
+	selected   int
+	playing    replay
+	playbackId int
+	speed      int // 1 or 2
+	elapsed    time.Duration
+	lastFrame  time.Time
+}
+
+// replayChoices the record comes first when there is one
+func replayChoices(s replayState) []replaySummary {
+	var choices []replaySummary
+	if s.record != nil {
+		choices = append(choices, *s.record)
+	}
+	return append(choices, s.list...)
+}
+
+func openReplays(m model) (model, tea.Cmd) {
+	list, err := fetchReplaySummaries(m.fingerprint)
+	if err != nil {
+		m.data.err = fmt.Errorf("error, when fetchReplaySummaries() for openReplays(). Error: %v", err)
+		HandleUnexpectedError(nil, m.data.err)
+		return m, nil
+	}
+	record, err := fetchRecordReplay(m.raceOptions.Mode)
+	if err != nil {
+		m.data.err = fmt.Errorf("error, when fetchRecordReplay() for openReplays(). Error: %v", err)
+		HandleUnexpectedError(nil, m.data.err)
+		return m, nil
+	}
+	m.replays = replayState{record: record, list: list, playbackId: m.replays.playbackId}
+	m.activeView = activeViewReplays
+	return m, nil
+}
+
+func playReplay(m model, raceResultId int64) (model, tea.Cmd) {
+	r, err := fetchReplay(raceResultId)
+	if err != nil {
+		m.data.err = fmt.Errorf("error, when fetchReplay() for playReplay(). Error: %v", err)
+		HandleUnexpectedError(nil, m.data.err)
+		return m, nil
+	}
+	m.replays.playing = r
+	m.replays.speed = 1
+	m.activeView = activeViewReplay
+	return restartReplay(m)
+}
+
+func restartReplay(m model) (model, tea.Cmd) {
+	m.replays.playbackId++
+	m.replays.elapsed = 0
+	m.replays.lastFrame = time.Now()
+	return m, nextReplayFrame(m.replays.playbackId)
+}
+
+func nextReplayFrame(playbackId int) tea.Cmd {
+	return tea.Tick(replayFrameInterval, func(t time.Time) tea.Msg {
+		return replayFrameMsg{playbackId: playbackId, at: t}
+	})
+}
+
+func updateReplays(m model, msg tea.Msg) (model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.termWidth = msg.Width
+		m.termHeight = msg.Height
+	case replayFrameMsg:
+		if m.activeView != activeViewReplay || msg.playbackId != m.replays.playbackId {
+			return m, nil
+		}
+		m.replays.elapsed += msg.at.Sub(m.replays.lastFrame) * time.Duration(m.replays.speed)
+		m.replays.lastFrame = msg.at
+		if m.replays.elapsed >= m.replays.playing.duration() {
+			m.replays.elapsed = m.replays.playing.duration()
+			return m, nil
+		}
+		return m, nextReplayFrame(m.replays.playbackId)
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC {
+			return m, tea.Quit
+		}
+		if m.activeView == activeViewReplay {
+			switch msg.String() {
+			case "esc":
+				m.replays.playbackId++
+				m.activeView = activeViewReplays
+			case "enter":
+				return restartReplay(m)
+			case "1":
+				m.replays.speed = 1
+			case "2":
+				m.replays.speed = 2
+			}
+			return m, nil
+		}
+		choices := replayChoices(m.replays)
+		switch msg.String() {
+		case "esc":
+			m.activeView = activeViewWelcome
+		case "up", "down":
+			if len(choices) > 0 {
+				step := 1
+				if msg.String() == "up" {
+					step = -1
+				}
+				m.replays.selected = cycleValue(rowIndexes(len(choices)), m.replays.selected, step)
+			}
+		case "pgup", "pgdown":
+			step := replayListRows
+			if msg.String() == "pgup" {
+				step = -step
+			}
+			m.replays.selected = max(0, min(len(choices)-1, m.replays.selected+step))
+		case "enter":
+			if len(choices) > 0 {
+				return playReplay(m, choices[m.replays.selected].raceResultId)
+			}
+		}
+	}
+	return m, nil
+}
+
+func replayLabel(s replaySummary) string {
+	result := fmt.Sprintf("%d wpm, %.0f%%", s.wordsPerMin, s.accuracy*100)
+	if s.didNotFinish {
+		result = "did not finish"
+	}
+	return fmt.Sprintf("#%-5d %s  %-8s %s", s.raceResultId, s.finishedAt.Format("Jan 02 15:04"), s.mode, result)
+}
+
+// replayListWindow the rows of a list of total to show so that selected stays in view
+func replayListWindow(selected int, total int, rows int) (start int, end int) {
+	start = max(0, min(selected-rows/2, total-rows))
+	return start, min(total, start+rows)
+}
+
+func getReplaysView(m model) string {
+	b := strings.Builder{}
+	b.WriteString("REPLAYS\n\n")
+	choices := replayChoices(m.replays)
+	if len(choices) == 0 {
+		b.WriteString("nothing to watch yet, finish a race first\n")
+	}
+	start, end := replayListWindow(m.replays.selected, len(choices), replayListRows)
+	if start > 0 {
+		b.WriteString(fmt.Sprintf("  ... %d newer\n", start))
+	}
+	for i := start; i < end; i++ {
+		s := choices[i]
+		pointer := " "
+		if i == m.replays.selected {
+			pointer = ">"
+		}
+		label := replayLabel(s)
+		if m.replays.record != nil && i == 0 {
+			holder := s.username
+			if holder == "" {
+				holder = "a guest"
+			}
+			label = fmt.Sprintf("record by %s: %s", holder, label)
+		}
+		b.WriteString(fmt.Sprintf("%s %s\n", pointer, label))
+	}
+	if end < len(choices) {
+		b.WriteString(fmt.Sprintf("  ... %d older\n", len(choices)-end))
+	}
+	b.WriteString("\n(UP/DOWN OR PGUP/PGDN TO PICK A RACE, ENTER TO WATCH IT, ESC TO GO BACK)")
+	b.WriteString("\n(SAVE ONE OF YOURS WITH: ssh terminaltype.com replay export <#>)")
+	return b.String()
+}
+
+func getReplayView(m model) string {
+	r := m.replays.playing
+	chars := strings.Split(r.text, "")
+	correctPos, incorrectPos, mistakes := replayPosition(r, m.replays.elapsed)
+	var wordBlock string
+	if r.mode == raceModeCode {
+		wordBlock = formatCodeBlock(chars, correctPos, incorrectPos, mistakes)
+	} else {
+		wordBlock = formatWordBlock(chars, correctPos, incorrectPos, mistakes, m.settings.typingTestDesiredWidth)
+	}
+	status := fmt.Sprintf("%.1fs at %dx", m.replays.elapsed.Seconds(), m.replays.speed)
+	if m.replays.elapsed >= r.duration() {
+		status = fmt.Sprintf("finished, %s", replayLabel(r.replaySummary))
+	}
+	return fmt.Sprintf(
+		"REPLAY\n\n%s\n\n%s\n\n(1 OR 2 FOR THE SPEED, ENTER TO WATCH AGAIN, ESC TO GO BACK)",
+		wordBlock,
+		status,
+	)
+}
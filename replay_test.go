@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_recordReplayEvent(t *testing.T) {
+	m := typedModel(t, "hello, (world)", "hex", preferences{})
+	m = backspace(m)
+	m = recordReplayEvent(m, "backspace", time.Now())
+	if len(m.replayEvents) != 4 {
+		t.Fatalf("error, expected 4 events but got %d", len(m.replayEvents))
+	}
+	last := m.replayEvents[3]
+	if last.Key != "backspace" || last.CorrectPos != 0 || last.IncorrectPos != 2 {
+		t.Errorf("error, expected the backspace to leave the cursor at 0/2 but got %+v", last)
+	}
+	if m.replayEvents[1].Key != "e" || m.replayEvents[1].CorrectPos != 2 {
+		t.Errorf("error, expected the second key to be a correct e but got %+v", m.replayEvents[1])
+	}
+}
+
+func Test_replayPosition(t *testing.T) {
+	events := []replayEvent{
+		{At: 100, Key: "h", CorrectPos: 1, IncorrectPos: 1},
+		{At: 200, Key: "x", CorrectPos: 2, IncorrectPos: 2},
+		{At: 300, Key: "l", CorrectPos: 3, IncorrectPos: 3},
+		{At: 400, Key: "backspace", CorrectPos: 2, IncorrectPos: 2},
+		{At: 500, Key: "backspace", CorrectPos: 1, IncorrectPos: 1},
+	}
+	r := replay{replaySummary: replaySummary{errorMode: errorModeFreeFlow}, text: "hello", events: events}
+	tests := []struct {
+		name          string
+		elapsed       time.Duration
+		wantCorrect   int
+		wantIncorrect int
+		wantMistakes  int
+	}{
+		{name: "nothing before the first key", elapsed: 50 * time.Millisecond},
+		{name: "a key the text didn't have is a mistake", elapsed: 300 * time.Millisecond, wantCorrect: 3, wantIncorrect: 3, wantMistakes: 1},
+		{name: "deleting a mistake forgets it", elapsed: time.Second, wantCorrect: 1, wantIncorrect: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			correct, incorrect, mistakes := replayPosition(r, tt.elapsed)
+			if correct != tt.wantCorrect || incorrect != tt.wantIncorrect {
+				t.Errorf("error, expected %d/%d but got %d/%d", tt.wantCorrect, tt.wantIncorrect, correct, incorrect)
+			}
+			if len(mistakes) != tt.wantMistakes {
+				t.Errorf("error, expected %d mistakes but got %v", tt.wantMistakes, mistakes)
+			}
+		})
+	}
+	if r.duration() != 500*time.Millisecond {
+		t.Errorf("error, expected the replay to last 500ms but got %v", r.duration())
+	}
+}
+
+func Test_replayListWindow(t *testing.T) {
+	tests := []struct {
+		name      string
+		selected  int
+		total     int
+		wantStart int
+		wantEnd   int
+	}{
+		{name: "a short list shows everything", selected: 2, total: 4, wantStart: 0, wantEnd: 4},
+		{name: "the top of a long list", selected: 1, total: 30, wantStart: 0, wantEnd: 10},
+		{name: "the selection stays in the middle", selected: 15, total: 30, wantStart: 10, wantEnd: 20},
+		{name: "the bottom of a long list", selected: 29, total: 30, wantStart: 20, wantEnd: 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := replayListWindow(tt.selected, tt.total, 10)
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("error, expected rows %d to %d but got %d to %d", tt.wantStart, tt.wantEnd, start, end)
+			}
+		})
+	}
+}
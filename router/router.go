@@ -37,6 +37,7 @@ func New(
         mux.HandleFunc("/hotreload", controllers.TemplateLoader.HandleHotReload)
     }
     mux.HandleFunc("/health", controllers.Health.Check)
+    mux.HandleFunc("/export", controllers.RaceHistory.Download)
     ui_util.InitStaticFiles(mux, config.UiPath + "/static")
     return &Router{ 
         mux: mux,
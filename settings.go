@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/JeremiahVaughan/terminaltype/config"
+)
+
+// settings the config values that can change while the server is running. A snapshot is never modified once it
+// has been stored, reloading swaps in a new one. Lobbies and sessions hold on to the snapshot they started with.
+type settings struct {
+	sentencesPerTypingTest    int
+	typingTestDesiredWidth    int
+	raceStartTimeoutInSeconds int
+	raceTimeout               time.Duration
+	raceIdleTimeout           time.Duration
+	sessionIdleTimeout        time.Duration
+	maxPlayersPerRace         int8
+	playerColors              []string
+	limits                    config.Limits
+}
+
+var currentSettings atomic.Pointer[settings]
+
+func init() {
+	currentSettings.Store(&settings{
+		sentencesPerTypingTest:    3,
+		typingTestDesiredWidth:    60,
+		raceStartTimeoutInSeconds: 10,
+		raceTimeout:               180 * time.Second,
+		raceIdleTimeout:           30 * time.Second,
+		sessionIdleTimeout:        15 * time.Minute,
+		maxPlayersPerRace:         5,
+		playerColors:              []string{"#00ff00", "#ff5600", "#0000ff", "#ffff00", "#ff00ff"},
+		limits: config.Limits{
+			ConnectionsPerMinutePerIp:  20,
+			ConnectionsPerMinutePerKey: 10,
+			RaceRegistrationsPerMinute: 20,
+			MaxSessionsPerIp:           10,
+			MaxSessionsPerKey:          3,
+		},
+	})
+}
+
+func runtimeSettings() *settings {
+	return currentSettings.Load()
+}
+
+func settingsFromConfig(c config.Config) *settings {
+	return &settings{
+		sentencesPerTypingTest:    c.NumberOfSentencesPerTypingTest,
+		typingTestDesiredWidth:    c.TypingTestDesiredWidth,
+		raceStartTimeoutInSeconds: c.RaceStartTimeoutInSeconds,
+		raceTimeout:               time.Duration(c.RaceTimeoutInSeconds) * time.Second,
+		raceIdleTimeout:           time.Duration(c.RaceIdleTimeoutInSeconds) * time.Second,
+		sessionIdleTimeout:        time.Duration(c.SessionIdleTimeoutInMinutes) * time.Minute,
+		maxPlayersPerRace:         c.MaxPlayersPerRace,
+		playerColors:              c.PlayerColors,
+		limits:                    c.Limits,
+	}
+}
+
+// playerColor wraps around so a race that started before a reload shrank the list of colors can't go out of bounds
+func (s *settings) playerColor(racerId int8) string {
+	return s.playerColors[int(racerId)%len(s.playerColors)]
+}
+
+// configReloadDebounce editors tend to write a file more than once when saving
+const configReloadDebounce = 500 * time.Millisecond
+
+// watchSettings reloads settings on SIGHUP and whenever the config file at configPath changes. Only the values
+// in settings are swapped, anything else (ports, host key, database) still needs a restart.
+func watchSettings(ctx context.Context, configPath string) error {
+	hangUps := make(chan os.Signal, 1)
+	signal.Notify(hangUps, syscall.SIGHUP)
+	defer signal.Stop(hangUps)
+
+	var fileEvents chan fsnotify.Event
+	if configPath != "" {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return fmt.Errorf("error, when creating config file watcher for watchSettings(). Error: %v", err)
+		}
+		defer watcher.Close()
+		// the directory is watched rather than the file since editors often replace the file instead of writing to it
+		err = watcher.Add(filepath.Dir(configPath))
+		if err != nil {
+			return fmt.Errorf("error, when watching config file directory for watchSettings(). Error: %v", err)
+		}
+		fileEvents = watcher.Events
+		go func() {
+			for err := range watcher.Errors {
+				log.Printf("error, config file watcher: %v", err)
+			}
+		}()
+	}
+
+	reload := time.NewTimer(configReloadDebounce)
+	reload.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hangUps:
+			log.Printf("received SIGHUP, reloading settings")
+			reloadSettings(ctx, configPath)
+		case event := <-fileEvents:
+			if filepath.Clean(event.Name) == filepath.Clean(configPath) &&
+				event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				reload.Reset(configReloadDebounce)
+			}
+		case <-reload.C:
+			log.Printf("config file changed, reloading settings")
+			reloadSettings(ctx, configPath)
+		}
+	}
+}
+
+// reloadSettings an invalid config leaves the current settings in place
+func reloadSettings(ctx context.Context, configPath string) {
+	c, err := config.New(ctx, configPath)
+	if err != nil {
+		log.Printf("error, keeping current settings since the new config could not be loaded. Error: %v", err)
+		return
+	}
+	next := settingsFromConfig(c)
+	previous := currentSettings.Swap(next)
+	if !reflect.DeepEqual(previous, next) {
+		log.Printf("settings reloaded: %+v", *next)
+	}
+}
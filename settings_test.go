@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"testing"
+)
+
+func Test_reloadSettings(t *testing.T) {
+	original := runtimeSettings()
+	t.Cleanup(func() {
+		currentSettings.Store(original)
+	})
+	t.Setenv("TERMINALTYPE_OPENAI_API_KEY", "key")
+	t.Setenv("TERMINALTYPE_HOST_KEY", base64.StdEncoding.EncodeToString([]byte("host key")))
+	path := t.TempDir() + "/config.json"
+
+	t.Run("valid config is swapped in", func(t *testing.T) {
+		err := os.WriteFile(path, []byte(`{"maxPlayersPerRace": 2, "typingTestDesiredWidth": 40}`), 0600)
+		if err != nil {
+			t.Fatalf("error, unexpected error: %v", err)
+		}
+		reloadSettings(context.Background(), path)
+		got := runtimeSettings()
+		if got.maxPlayersPerRace != 2 || got.typingTestDesiredWidth != 40 {
+			t.Errorf("error, expected the new settings but got %+v", *got)
+		}
+	})
+	t.Run("invalid config keeps the current settings", func(t *testing.T) {
+		before := runtimeSettings()
+		err := os.WriteFile(path, []byte(`{"maxPlayersPerRace": 9}`), 0600)
+		if err != nil {
+			t.Fatalf("error, unexpected error: %v", err)
+		}
+		reloadSettings(context.Background(), path)
+		if runtimeSettings() != before {
+			t.Errorf("error, expected the settings to be left alone")
+		}
+	})
+}
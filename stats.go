@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// modeStats a player's totals for one mode, or for all of them when mode is empty
+type modeStats struct {
+	mode               raceMode
+	races              int
+	finished           int
+	bestWordsPerMin    int
+	totalWordsPerMin   int     // over finished races
+	totalAccuracy      float64 // over finished races
+	lastFinishedAtUnix int64
+}
+
+func (s modeStats) averageWordsPerMin() int {
+	if s.finished == 0 {
+		return 0
+	}
+	return s.totalWordsPerMin / s.finished
+}
+
+func (s modeStats) averageAccuracy() float64 {
+	if s.finished == 0 {
+		return 0
+	}
+	return s.totalAccuracy / float64(s.finished)
+}
+
+// fetchModeStats the modes the player has raced the most come first
+func fetchModeStats(identityId string) ([]modeStats, error) {
+	rows, err := theClients.Database.Conn.Query(
+		`SELECT mode,
+	COUNT(*),
+	SUM(1 - did_not_finish),
+	COALESCE(MAX(CASE WHEN did_not_finish = 0 THEN words_per_min END), 0),
+	COALESCE(SUM(CASE WHEN did_not_finish = 0 THEN words_per_min END), 0),
+	COALESCE(SUM(CASE WHEN did_not_finish = 0 THEN accuracy END), 0),
+	MAX(finished_at)
+FROM race_result
+WHERE ssh_finger_print = ?
+GROUP BY mode
+ORDER BY COUNT(*) DESC, mode`,
+		identityId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error, when querying race results for fetchModeStats(). Error: %v", err)
+	}
+	defer rows.Close()
+	var result []modeStats
+	for rows.Next() {
+		var s modeStats
+		var mode string
+		err = rows.Scan(&mode, &s.races, &s.finished, &s.bestWordsPerMin, &s.totalWordsPerMin, &s.totalAccuracy, &s.lastFinishedAtUnix)
+		if err != nil {
+			return nil, fmt.Errorf("error, when scanning race results for fetchModeStats(). Error: %v", err)
+		}
+		s.mode = raceMode(mode)
+		result = append(result, s)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error, when reading race results for fetchModeStats(). Error: %v", err)
+	}
+	return result, nil
+}
+
+// totalModeStats adds up the stats of every mode
+func totalModeStats(stats []modeStats) modeStats {
+	var total modeStats
+	for _, s := range stats {
+		total.races += s.races
+		total.finished += s.finished
+		total.bestWordsPerMin = max(total.bestWordsPerMin, s.bestWordsPerMin)
+		total.totalWordsPerMin += s.totalWordsPerMin
+		total.totalAccuracy += s.totalAccuracy
+		total.lastFinishedAtUnix = max(total.lastFinishedAtUnix, s.lastFinishedAtUnix)
+	}
+	return total
+}
+
+func writeModeStats(w io.Writer, stats []modeStats) error {
+	if len(stats) == 0 {
+		_, err := fmt.Fprintln(w, "no races yet, connect without a command to play one")
+		return err
+	}
+	total := totalModeStats(stats)
+	fmt.Fprintf(w, "races: %d, finished: %d, last race: %s\n\n", total.races, total.finished, time.Unix(total.lastFinishedAtUnix, 0).UTC().Format("2006-01-02"))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODE\tRACES\tFINISHED\tBEST WPM\tAVG WPM\tACCURACY")
+	for _, s := range append(stats, total) {
+		mode := string(s.mode)
+		if s.mode == "" {
+			mode = "all"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%.0f%%\n", mode, s.races, s.finished, s.bestWordsPerMin, s.averageWordsPerMin(), s.averageAccuracy()*100)
+	}
+	return tw.Flush()
+}
+
+// leaderboardEntry a player's best finished race in a mode
+type leaderboardEntry struct {
+	username    string
+	guest       bool
+	wordsPerMin int
+	accuracy    float64
+	finishedAt  time.Time
+}
+
+func (e leaderboardEntry) name() string {
+	switch {
+	case e.username != "":
+		return e.username
+	case e.guest:
+		return "guest"
+	default:
+		return "unnamed player"
+	}
+}
+
+// fetchLeaderboard each player's best race, ties go to whoever got there first. Guests have no identity, their
+// results are left out when they aren't meant to be on the leaderboards, including ones recorded before that was set.
+func fetchLeaderboard(mode raceMode, limit int, excludeGuests bool) ([]leaderboardEntry, error) {
+	guestFilter := ""
+	if excludeGuests {
+		guestFilter = "AND i.id IS NOT NULL"
+	}
+	// sqlite takes the bare columns from the row MAX picked
+	rows, err := theClients.Database.Conn.Query(
+		fmt.Sprintf(`SELECT COALESCE(p.username, ''), i.id IS NULL, MAX(r.words_per_min), r.accuracy, r.finished_at
+FROM race_result r
+LEFT JOIN identity i ON i.id = r.ssh_finger_print
+LEFT JOIN player p ON p.identity_id = r.ssh_finger_print
+WHERE r.mode = ? AND r.did_not_finish = 0 %s
+GROUP BY r.ssh_finger_print
+ORDER BY MAX(r.words_per_min) DESC, r.finished_at ASC
+LIMIT ?`, guestFilter),
+		string(mode),
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error, when querying race results for fetchLeaderboard(). Error: %v", err)
+	}
+	defer rows.Close()
+	var result []leaderboardEntry
+	for rows.Next() {
+		var e leaderboardEntry
+		var finishedAt int64
+		err = rows.Scan(&e.username, &e.guest, &e.wordsPerMin, &e.accuracy, &finishedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error, when scanning race results for fetchLeaderboard(). Error: %v", err)
+		}
+		e.finishedAt = time.Unix(finishedAt, 0)
+		result = append(result, e)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error, when reading race results for fetchLeaderboard(). Error: %v", err)
+	}
+	return result, nil
+}
+
+func writeLeaderboard(w io.Writer, mode raceMode, entries []leaderboardEntry) error {
+	if len(entries) == 0 {
+		_, err := fmt.Fprintf(w, "nobody has finished a %s race yet\n", mode)
+		return err
+	}
+	fmt.Fprintf(w, "fastest %s races\n\n", mode)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tPLAYER\tWPM\tACCURACY\tDATE")
+	for i, e := range entries {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%.0f%%\t%s\n", i+1, e.name(), e.wordsPerMin, e.accuracy*100, e.finishedAt.UTC().Format("2006-01-02"))
+	}
+	return tw.Flush()
+}
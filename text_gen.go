@@ -6,13 +6,20 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
+	"math"
 	"strings"
 	"time"
+	"unicode"
 
 	openai "github.com/sashabaranov/go-openai"
 )
 
 func ensureEnoughGeneratedText(ctx context.Context) error {
+	err := backfillSentenceDifficulty()
+	if err != nil {
+		return fmt.Errorf("error, when backfillSentenceDifficulty() for ensureEnoughGeneratedText(). Error: %v", err)
+	}
 	for {
 		numberOfGeneratedSentences, err := fetchNumberOfGeneratedSentences()
 		if err != nil {
@@ -23,7 +30,7 @@ func ensureEnoughGeneratedText(ctx context.Context) error {
 			return fmt.Errorf("error, when fetchHighestTypingTestCompletionCount() for ensureEnoughGeneratedText(). Error: %v", err)
 		}
 		enough := isEnoughTextGenerated(
-			sentencesPerTypingTest,
+			runtimeSettings().sentencesPerTypingTest,
 			numberOfGeneratedSentences,
 			highestTypeTestCompletionCount,
 		)
@@ -33,7 +40,7 @@ func ensureEnoughGeneratedText(ctx context.Context) error {
 				return fmt.Errorf("error, when gatherRandomText() for ensureEnoughGeneratedText(). Error: %v", err)
 			}
 			randomText = filterOutWeirdText(randomText)
-			err = persistGeneratedSentences(randomText)
+			err = persistGeneratedSentences(randomText, sentenceSourceOpenAI)
 			if err != nil {
 				return fmt.Errorf("error, when persistGeneratedSentences() for ensureEnoughGeneratedText(). Error: %v", err)
 			}
@@ -78,9 +85,15 @@ func gatherRandomText(ctx context.Context) (string, error) {
 	}
 }
 
-func persistGeneratedSentences(text string) error {
+const sentenceSourceOpenAI = "openai"
+
+func persistGeneratedSentences(text string, source string) error {
 	sentences := strings.Split(text, ".")
-	sqlStatement, args := generateSqlForSentences(sentences)
+	sqlStatement, args := generateSqlForSentences(sentences, source)
+	if len(args) == 0 {
+		// nothing worth keeping came back
+		return nil
+	}
 	_, err := theClients.Database.Conn.Exec(sqlStatement, args...)
 	if err != nil {
 		return fmt.Errorf("error, when executing sql statement for persistGeneratedSentences(). Error: %v", err)
@@ -88,22 +101,272 @@ func persistGeneratedSentences(text string) error {
 	return nil
 }
 
-func generateSqlForSentences(sentences []string) (string, []any) {
+func persistSentenceRecords(records []sentenceRecord) error {
+	sqlStatement, args := generateSqlForSentenceRecords(records)
+	if len(args) == 0 {
+		return nil
+	}
+	_, err := theClients.Database.Conn.Exec(sqlStatement, args...)
+	if err != nil {
+		return fmt.Errorf("error, when executing sql statement for persistSentenceRecords(). Error: %v", err)
+	}
+	return nil
+}
+
+const (
+	sentenceKindSentence = "sentence"
+	sentenceKindQuote    = "quote"
+)
+
+// sentenceRecord a row headed for the sentence pool. Generated sentences and curated quotes share the pool,
+// kind tells them apart.
+type sentenceRecord struct {
+	text   string
+	source string
+	kind   string
+	author string
+	work   string
+	// charCount optional, the length of the text is used when not provided
+	charCount int
+}
+
+// generateSqlForSentences sentences that already exist in the pool (compared by their normalized text) are skipped by the database
+func generateSqlForSentences(sentences []string, source string) (string, []any) {
+	records := make([]sentenceRecord, len(sentences))
+	for i, s := range sentences {
+		records[i] = sentenceRecord{
+			text:   s,
+			source: source,
+			kind:   sentenceKindSentence,
+		}
+	}
+	return generateSqlForSentenceRecords(records)
+}
+
+func generateSqlForSentenceRecords(records []sentenceRecord) (string, []any) {
 	var inserts []string
 	var args []any
-	var builder strings.Builder
-	for _, s := range sentences {
-		s = strings.ReplaceAll(s, "\n", "")
-		s = strings.TrimSpace(s)
+	for _, r := range records {
+		s := strings.Join(strings.Fields(r.text), " ")
 		if len(s) < 5 { // junk sentence
 			continue
 		}
-		builder.WriteString(s)
-		args = append(args, builder.String())
-		builder.Reset()
-		inserts = append(inserts, "(?)")
+		charCount := r.charCount
+		if charCount <= 0 {
+			charCount = len(s)
+		}
+		args = append(
+			args,
+			s,
+			normalizeSentence(s),
+			r.source,
+			r.kind,
+			r.author,
+			r.work,
+			charCount,
+			countWords(s),
+			scoreSentenceDifficulty(s),
+		)
+		inserts = append(inserts, "(?, ?, ?, ?, ?, ?, ?, ?, ?)")
 	}
-	return fmt.Sprintf("INSERT INTO sentence (text) VALUES %s", strings.Join(inserts, ",")), args
+	return fmt.Sprintf(
+		"INSERT OR IGNORE INTO sentence (text, normalized_text, source, kind, author, work, char_count, word_count, difficulty) VALUES %s",
+		strings.Join(inserts, ","),
+	), args
+}
+
+// renormalizeSentences rows backfilled by the 02 migration only had their ends trimmed, so inner whitespace could
+// hide a duplicate from the unique index. A row that turns out to duplicate another is merged into the one that
+// already holds the normalized text, including what racers have seen of it.
+func renormalizeSentences() error {
+	tx, err := theClients.Database.Conn.Begin()
+	if err != nil {
+		return fmt.Errorf("error, when beginning transaction for renormalizeSentences(). Error: %v", err)
+	}
+	defer tx.Rollback()
+	rows, err := tx.Query(`SELECT id, text, normalized_text FROM sentence ORDER BY id`)
+	if err != nil {
+		return fmt.Errorf("error, when querying sentences for renormalizeSentences(). Error: %v", err)
+	}
+	type staleSentence struct {
+		id         int64
+		text       string
+		normalized string
+	}
+	var stale []staleSentence
+	for rows.Next() {
+		var s staleSentence
+		err = rows.Scan(&s.id, &s.text, &s.normalized)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("error, when scanning sentences for renormalizeSentences(). Error: %v", err)
+		}
+		if s.normalized != normalizeSentence(s.text) {
+			stale = append(stale, s)
+		}
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("error, when reading sentences for renormalizeSentences(). Error: %v", err)
+	}
+
+	for _, s := range stale {
+		normalized := normalizeSentence(s.text)
+		var keepId int64
+		err = tx.QueryRow(`SELECT id FROM sentence WHERE normalized_text = ?`, normalized).Scan(&keepId)
+		if errors.Is(err, sql.ErrNoRows) {
+			_, err = tx.Exec(
+				`UPDATE sentence SET normalized_text = ?, word_count = ? WHERE id = ?`,
+				normalized,
+				countWords(s.text),
+				s.id,
+			)
+			if err != nil {
+				return fmt.Errorf("error, when updating sentence for renormalizeSentences(). Error: %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error, when querying duplicate sentence for renormalizeSentences(). Error: %v", err)
+		}
+		merges := []struct {
+			query string
+			args  []any
+		}{
+			{
+				query: `INSERT INTO sentence_served (ssh_finger_print, sentence_id, served_count, last_served_at)
+SELECT ssh_finger_print, ?, served_count, last_served_at
+FROM sentence_served
+WHERE sentence_id = ?
+ON CONFLICT (ssh_finger_print, sentence_id) DO UPDATE
+SET served_count = served_count + excluded.served_count,
+    last_served_at = MAX(last_served_at, excluded.last_served_at)`,
+				args: []any{keepId, s.id},
+			},
+			{query: `DELETE FROM sentence_served WHERE sentence_id = ?`, args: []any{s.id}},
+			{
+				query: `UPDATE sentence SET times_served = times_served + (SELECT times_served FROM sentence WHERE id = ?) WHERE id = ?`,
+				args:  []any{s.id, keepId},
+			},
+			{query: `DELETE FROM sentence WHERE id = ?`, args: []any{s.id}},
+		}
+		for _, merge := range merges {
+			_, err = tx.Exec(merge.query, merge.args...)
+			if err != nil {
+				return fmt.Errorf("error, when merging duplicate sentence for renormalizeSentences(). Error: %v", err)
+			}
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error, when committing for renormalizeSentences(). Error: %v", err)
+	}
+	return nil
+}
+
+// normalizeSentence produces the value the sentence pool uses to detect duplicates
+func normalizeSentence(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+func countWords(s string) int {
+	return len(strings.Fields(s))
+}
+
+// scoreSentenceDifficulty higher is harder. Uncommon words, punctuation, capitals, numbers and long words all
+// add to the score. The score is only meaningful relative to other sentences, it is always at least 1 so
+// unscored sentences (0) can be told apart.
+func scoreSentenceDifficulty(s string) float64 {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return 1
+	}
+	uncommonWords := 0
+	letterCount := 0
+	for _, w := range words {
+		w = strings.ToLower(strings.TrimFunc(w, func(r rune) bool {
+			return !unicode.IsLetter(r)
+		}))
+		if !commonEnglishWordSet[w] {
+			uncommonWords++
+		}
+		letterCount += len(w)
+	}
+	var punctuation, capitals, digits int
+	for _, r := range s {
+		switch {
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			punctuation++
+		case unicode.IsUpper(r):
+			capitals++
+		case unicode.IsDigit(r):
+			digits++
+		}
+	}
+	charCount := float64(len(s))
+	averageWordLength := float64(letterCount) / float64(len(words))
+	score := 1.0
+	score += 4 * float64(uncommonWords) / float64(len(words))
+	score += 20 * float64(punctuation) / charCount
+	score += 10 * float64(capitals) / charCount
+	score += 20 * float64(digits) / charCount
+	score += 0.25 * math.Max(0, averageWordLength-4)
+	return score
+}
+
+// backfillSentenceDifficulty scores sentences that made it into the pool before difficulty scoring existed
+func backfillSentenceDifficulty() error {
+	rows, err := theClients.Database.Conn.Query(
+		`SELECT id, text
+FROM sentence
+WHERE difficulty = 0`,
+	)
+	if err != nil {
+		return fmt.Errorf("error, when attempting to retrieve unscored sentences. Error: %v", err)
+	}
+	scores := make(map[int64]float64)
+	for rows.Next() {
+		var id int64
+		var text string
+		err = rows.Scan(&id, &text)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("error, when scanning unscored sentences. Error: %v", err)
+		}
+		scores[id] = scoreSentenceDifficulty(text)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("error, when iterating through unscored sentences. Error: %v", err)
+	}
+	if len(scores) == 0 {
+		return nil
+	}
+	log.Printf("scoring the difficulty of %d sentences", len(scores))
+	tx, err := theClients.Database.Conn.Begin()
+	if err != nil {
+		return fmt.Errorf("error, when starting transaction for backfillSentenceDifficulty(). Error: %v", err)
+	}
+	defer tx.Rollback()
+	for id, score := range scores {
+		_, err = tx.Exec(
+			`UPDATE sentence
+SET difficulty = ?
+WHERE id = ?`,
+			score,
+			id,
+		)
+		if err != nil {
+			return fmt.Errorf("error, when updating sentence difficulty for backfillSentenceDifficulty(). Error: %v", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error, when committing transaction for backfillSentenceDifficulty(). Error: %v", err)
+	}
+	return nil
 }
 
 func isEnoughTextGenerated(
@@ -149,10 +412,10 @@ LIMIT 1`,
 func fetchNumberOfGeneratedSentences() (int, error) {
 	var result int
 	err := theClients.Database.Conn.QueryRow(
-		`SELECT id
+		`SELECT COUNT(*)
 FROM sentence
-ORDER BY id DESC
-LIMIT 1`,
+WHERE kind = ?`,
+		sentenceKindSentence,
 	).Scan(
 		&result,
 	)
@@ -5,10 +5,10 @@ import "testing"
 func Test_generateSqlForSentences(t *testing.T) {
 	t.Run("happy path", func(t *testing.T) {
 		input := []string{" Hello sir", "Me too "}
-		expected := "INSERT INTO sentence (text) VALUES (?),(?)"
-		got, gotArgs := generateSqlForSentences(input)
-		if len(gotArgs) != len(input) {
-			t.Errorf("error, expected %d args but got %d args", len(input), len(gotArgs))
+		expected := "INSERT OR IGNORE INTO sentence (text, normalized_text, source, kind, author, work, char_count, word_count, difficulty) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?),(?, ?, ?, ?, ?, ?, ?, ?, ?)"
+		got, gotArgs := generateSqlForSentences(input, sentenceSourceOpenAI)
+		if len(gotArgs) != len(input)*9 {
+			t.Errorf("error, expected %d args but got %d args", len(input)*9, len(gotArgs))
 		}
 		if got != expected {
 			t.Errorf("error, expected '%s' but got '%s' args", expected, got)
@@ -16,6 +16,33 @@ func Test_generateSqlForSentences(t *testing.T) {
 	})
 }
 
+func Test_normalizeSentence(t *testing.T) {
+	t.Run("case and spacing are ignored", func(t *testing.T) {
+		input := "  The Cat\n sat   on the MAT "
+		expected := "the cat sat on the mat"
+		got := normalizeSentence(input)
+		if got != expected {
+			t.Errorf("error, expected '%s' but got '%s'", expected, got)
+		}
+	})
+}
+
+func Test_scoreSentenceDifficulty(t *testing.T) {
+	t.Run("harder text scores higher", func(t *testing.T) {
+		easy := scoreSentenceDifficulty("the man said he would come back when he could")
+		hard := scoreSentenceDifficulty("Dr. Quillfeather's 37 manuscripts (circa 1842) were, regrettably, misplaced!")
+		if easy >= hard {
+			t.Errorf("error, expected easy score %f to be lower than hard score %f", easy, hard)
+		}
+	})
+	t.Run("never scores below one", func(t *testing.T) {
+		got := scoreSentenceDifficulty("")
+		if got < 1 {
+			t.Errorf("error, expected a score of at least 1 but got %f", got)
+		}
+	})
+}
+
 func Test_isEnoughTextGenerated(t *testing.T) {
 	sentencesPerTypingTest := 5
 
@@ -95,3 +122,45 @@ func Test_filterOutWeirdText(t *testing.T) {
 		}
 	})
 }
+
+func Test_renormalizeSentences(t *testing.T) {
+	db := newTestDatabase(t)
+	// the way the 02 migration backfilled rows, inner whitespace left alone
+	mustExec(t, db, `INSERT INTO sentence (id, text, normalized_text, word_count, times_served) VALUES (1, 'The  cat sat', 'the  cat sat', 2, 4)`)
+	mustExec(t, db, `INSERT INTO sentence (id, text, normalized_text, word_count, times_served) VALUES (2, 'the cat sat', 'the cat sat', 3, 1)`)
+	mustExec(t, db, `INSERT INTO sentence (id, text, normalized_text, word_count) VALUES (3, 'A  dog ran', 'a  dog ran', 2)`)
+	mustExec(t, db, `INSERT INTO sentence_served (ssh_finger_print, sentence_id, served_count, last_served_at) VALUES ('both', 1, 2, 100), ('both', 2, 1, 50), ('stale only', 1, 2, 70)`)
+
+	err := renormalizeSentences()
+	if err != nil {
+		t.Fatalf("error, unexpected error: %v", err)
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM sentence WHERE id = 1`); n != 0 {
+		t.Errorf("error, expected the duplicate to be merged away")
+	}
+	if n := countRows(t, db, `SELECT times_served FROM sentence WHERE id = 2`); n != 5 {
+		t.Errorf("error, expected the times served to be summed to 5 but got %d", n)
+	}
+	if n := countRows(t, db, `SELECT served_count FROM sentence_served WHERE ssh_finger_print = 'both' AND sentence_id = 2`); n != 3 {
+		t.Errorf("error, expected the served counts to be summed to 3 but got %d", n)
+	}
+	if n := countRows(t, db, `SELECT last_served_at FROM sentence_served WHERE ssh_finger_print = 'both' AND sentence_id = 2`); n != 100 {
+		t.Errorf("error, expected the latest serving to be kept but got %d", n)
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM sentence_served WHERE ssh_finger_print = 'stale only' AND sentence_id = 2`); n != 1 {
+		t.Errorf("error, expected what was seen of the duplicate to move over")
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM sentence_served WHERE sentence_id = 1`); n != 0 {
+		t.Errorf("error, expected nothing left pointing at the duplicate but found %d", n)
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM sentence WHERE id = 3 AND normalized_text = 'a dog ran' AND word_count = 3`); n != 1 {
+		t.Errorf("error, expected a row without a duplicate to be renormalized in place")
+	}
+	err = persistSentenceRecords([]sentenceRecord{{text: "A dog   ran", source: "test", kind: sentenceKindSentence}})
+	if err != nil {
+		t.Fatalf("error, unexpected error: %v", err)
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM sentence`); n != 2 {
+		t.Errorf("error, expected the unique index to catch the new duplicate but there are %d sentences", n)
+	}
+}
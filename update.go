@@ -1,14 +1,9 @@
 package main
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
-	"strings"
 	"time"
 
-	"github.com/nats-io/nats.go"
-
 	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/stopwatch"
@@ -22,11 +17,75 @@ const (
 	activeViewWelcome      activeView = "w"
 	activeViewRace         activeView = "r"
 	activeViewRaceFinished activeView = "rs"
+	activeViewCustomWords  activeView = "cw"
+	activeViewProfile      activeView = "p"
+	activeViewAccount      activeView = "a"
+	activeViewReplays      activeView = "rl"
+	activeViewReplay       activeView = "rp"
 )
 
+// raceTimeUpMsg sent when the time limit of a timed race runs out
+type raceTimeUpMsg struct {
+	raceStartTime int64
+}
+
+// raceTimedOutMsg sent when a race has run for as long as races are allowed to
+type raceTimedOutMsg struct {
+	raceStartTime int64
+}
+
+// typeKey handles a key typed during a race, once the player has gone wrong every key just extends the incorrect run
+// until they delete back to where they went wrong, or until the end of the word when errors are confined to it
+func typeKey(m model, cmd tea.Cmd, keyMsg string) (model, tea.Cmd) {
+	if m.incorrectPos > m.correctPos {
+		if canExtendErrorRun(m) {
+			m.incorrectPos++
+		}
+	} else if m.correctPos < len(m.raceWordsCharSlice) && m.incorrectPos < len(m.raceWordsCharSlice) {
+		var keyTypedCmd tea.Cmd
+		m, keyTypedCmd = evaluateTypedKeyMatch(m, cmd, keyMsg)
+		cmd = tea.Batch(cmd, keyTypedCmd)
+	}
+	// recorded before the race ends so the replay has the last key
+	m = recordReplayEvent(m, keyMsg, time.Now())
+	if m.correctPos >= len(m.raceWordsCharSlice) {
+		return endRace(m, cmd)
+	}
+	return m, cmd
+}
+
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 
+	// modified keys like shift+space arrive as escape sequences bubbletea doesn't know, the rest of them are dropped
+	if seq, ok := unknownCSISequence(msg); ok {
+		key, ok := parseModifiedKey(seq)
+		if !ok {
+			return m, nil
+		}
+		msg = key
+	}
+
+	switch msg := msg.(type) {
+	case idleCheckMsg:
+		return handleIdleCheck(m, msg.now)
+	case tea.KeyMsg:
+		m.lastInputAt = time.Now()
+	}
+
+	if m.activeView == activeViewCustomWords {
+		return updateCustomWordsEditor(m, msg)
+	}
+	if m.activeView == activeViewProfile {
+		return updateProfile(m, msg)
+	}
+	if m.activeView == activeViewAccount {
+		return updateAccount(m, msg)
+	}
+	if m.activeView == activeViewReplays || m.activeView == activeViewReplay {
+		return updateReplays(m, msg)
+	}
+
 	switch msg := msg.(type) {
 	case tea.MouseMsg:
 		// Ignore all mouse messages, this is a typing game
@@ -36,143 +95,91 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case tea.KeyCtrlC:
 			return m, tea.Quit
 		}
+		if m.loading && msg.Type == tea.KeyEsc {
+			return cancelRegistration(m), cmd
+		}
 		// ignore key presses if loading
 		if !m.loading {
 			// reset any errors or validation messages on key press if not loading
 			m.data.err = nil
+			if m.activeView == activeViewRace && !raceUnderway(m, time.Now()) && msg.Type != tea.KeyEsc {
+				return m, cmd
+			}
 			switch msg.Type {
 			case tea.KeyEnter:
 				if m.activeView == activeViewWelcome || m.activeView == activeViewRaceFinished {
-					m.loading = true
-					md := m.data
-					if m.natsConnection == nil {
-						m.natsConnection, m.data.err = connectToNats()
-						if m.data.err != nil {
-							m.data.err = fmt.Errorf("error, when connectToNats() for Update(). Error: %v", m.data.err)
-							HandleUnexpectedError(nil, m.data.err)
-							return m, cmd
-						}
-					}
-					// todo figure out the correct way to determine this channels buffer size
-					m.allRacerProgressChan = make(chan *nats.Msg, 30)
-					m.raceCtx, m.raceCancel = context.WithCancel(m.ctx)
-					var sub *nats.Subscription
-					sub, m.data.err = m.natsConnection.SubscribeSync(m.fingerprint)
-					if m.data.err != nil {
-						m.data.err = fmt.Errorf("error, when subscribing to registration queue for Update(). Error: %v", m.data.err)
-						HandleUnexpectedError(nil, m.data.err)
+					if !allowRaceRegistration(m) {
+						m.data.err = errTooManyRegistrations
 						return m, cmd
 					}
-					sendMsg := nats.Msg{
-						Subject: raceRegistrationRequestQueueId,
-						Data:    []byte(m.fingerprint),
-					}
-					m.data.err = m.natsConnection.PublishMsg(&sendMsg)
-					if m.data.err != nil {
-						m.data.err = fmt.Errorf("error, when publishing registation request message for Update(). Error: %v", m.data.err)
-						HandleUnexpectedError(nil, m.data.err)
-						return m, cmd
-					}
-					// waits for twice as long as the race timeout and then assumes failure
-					raceStartTimeout := time.Duration(raceStartTimeoutInSeconds) * 2 * time.Second
-					var subMsg *nats.Msg
-					subMsg, m.data.err = sub.NextMsg(raceStartTimeout)
-					if m.data.err != nil {
-						m.data.err = fmt.Errorf("error, when recieving race registration start time for Update(). Error: %v", m.data.err)
-						HandleUnexpectedError(nil, m.data.err)
-						return m, cmd
+					return registerForRace(m)
+				} else if m.activeView == activeViewRace && m.data.options.Mode == raceModeCode {
+					return typeKey(m, cmd, "\n")
+				}
+			case tea.KeyEsc:
+				if m.activeView == activeViewRace {
+					m, cmd = forfeitRace(m, "you left the race")
+					m.activeView = activeViewWelcome
+					return m, cmd
+				}
+			case tea.KeyUp, tea.KeyDown:
+				if m.activeView == activeViewWelcome || m.activeView == activeViewRaceFinished {
+					step := 1
+					if msg.Type == tea.KeyUp {
+						step = -1
 					}
-					var theResponse RegResponse
-					m.data.err = json.Unmarshal(subMsg.Data, &theResponse)
-					if m.data.err != nil {
-						m.data.err = fmt.Errorf("error, when decoding RegResponse for Update(). Error: %v", m.data.err)
-						HandleUnexpectedError(nil, m.data.err)
-						return m, cmd
+					m.selectedOptionRow = cycleValue(rowIndexes(len(raceOptionRows)), m.selectedOptionRow, step)
+				}
+			case tea.KeyLeft, tea.KeyRight:
+				if m.activeView == activeViewWelcome || m.activeView == activeViewRaceFinished {
+					step := 1
+					if msg.Type == tea.KeyLeft {
+						step = -1
 					}
-					timeRemainingTillStart := theResponse.RaceStartTime - time.Now().Unix()
-					m.raceStartCountDown = timer.NewWithInterval(time.Duration(timeRemainingTillStart)*time.Second, time.Second)
-					startTimeCmd := m.raceStartCountDown.Init()
-					cmd = tea.Batch(cmd, startTimeCmd)
-					m.data.raceId = theResponse.RaceId
-					go func() {
-						defer sub.Unsubscribe()
-						subMsg, md.err = sub.NextMsg(raceStartTimeout)
-						if md.err != nil {
-							md.err = fmt.Errorf("error, when retrieving registration response message for Update(). Error: %v", md.err)
-							HandleUnexpectedError(nil, md.err)
-							m.loadingFinished <- md
-							return
-						}
-						var reg RaceRegistration
-						reg, md.err = decodeRaceRegistration(subMsg.Data)
-						if md.err != nil {
-							md.err = fmt.Errorf("error, when decoding registration response message for Update(). Error: %v", md.err)
-							HandleUnexpectedError(nil, md.err)
-							m.loadingFinished <- md
-							return
-						}
-
-						md.raceId = reg.RaceId
-						md.raceWords = reg.RaceWords
-						md.wordCount = reg.WordCount
-						md.allRacerProgress = reg.AllRaceProgress
-						md.racerCount = reg.RacerCount
-						go monitorRaceProgression(
-							m.raceCtx,
-							m.natsConnection,
-							md.raceId,
-							m.allRacerProgressChan,
-							m.raceCancel,
-						)
-
-						m.loadingFinished <- md
-					}()
-					cmd = tea.Batch(cmd, m.spinner.Tick)
-					return m, cmd
+					m.raceOptions = raceOptionRows[m.selectedOptionRow].cycle(m.raceOptions, step)
 				}
 			case tea.KeyCtrlW:
-				// todo punctuation needs to stagger ctrl W, like it does in vim
-				// todo consider making commas, periods, and spaces at the end of the word not part of the word itself so they don't cause the adjecent word to also become incorrect
 				if m.activeView == activeViewRace {
-					i := m.incorrectPos
-					j := 0
-					for i > 0 && (m.data.raceWords[i-1] != ' ' || j == 0) {
-						i--
-						j++
-					}
-					if m.correctPos > i {
-						m.correctPos = i
-					}
-					m.incorrectPos = i
+					m = deleteWord(m, true)
+					m = recordReplayEvent(m, msg.String(), time.Now())
+				}
+			case tea.KeyCtrlU:
+				if m.activeView == activeViewRace {
+					m = clearWord(m)
+					m = recordReplayEvent(m, msg.String(), time.Now())
 				}
 			case tea.KeyCtrlH, tea.KeyBackspace:
 				if m.activeView == activeViewRace {
-					if m.incorrectPos > m.correctPos {
-						if m.incorrectPos > 0 {
-							m.incorrectPos--
-						}
+					if msg.Alt {
+						m = deleteWord(m, false)
 					} else {
-						if m.correctPos > 0 {
-							m.correctPos--
-						}
-						if m.incorrectPos > 0 {
-							m.incorrectPos--
-						}
+						m = backspace(m)
 					}
+					m = recordReplayEvent(m, msg.String(), time.Now())
 				}
 			default:
+				if (m.activeView == activeViewWelcome || m.activeView == activeViewRaceFinished) &&
+					m.raceOptions.Mode == raceModeCustom && msg.String() == "e" {
+					return openCustomWordsEditor(m)
+				}
+				if (m.activeView == activeViewWelcome || m.activeView == activeViewRaceFinished) && msg.String() == "p" {
+					return openProfile(m)
+				}
+				if (m.activeView == activeViewWelcome || m.activeView == activeViewRaceFinished) && msg.String() == "a" {
+					return openAccount(m)
+				}
+				if (m.activeView == activeViewWelcome || m.activeView == activeViewRaceFinished) && msg.String() == "r" {
+					return openReplays(m)
+				}
 				if m.activeView == activeViewRace {
-					if m.incorrectPos > m.correctPos {
-						if m.incorrectPos < len(m.raceWordsCharSlice) {
-							m.incorrectPos++
+					for _, char := range typedChars(msg, m.data.options.Mode) {
+						// the race can end part way through keys that arrived together
+						if m.activeView != activeViewRace {
+							break
 						}
-					} else if m.correctPos < len(m.raceWordsCharSlice) && m.incorrectPos < len(m.raceWordsCharSlice) {
-						keyMsg := msg.String()
-						var keyTypedCmd tea.Cmd
-						m, keyTypedCmd = evaluateTypedKeyMatch(m, cmd, keyMsg)
-						cmd = tea.Batch(cmd, keyTypedCmd)
-						return m, cmd
+						m, cmd = typeKey(m, cmd, char)
 					}
+					return m, cmd
 				}
 			}
 		}
@@ -182,16 +189,10 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		cmd = tea.Batch(cmd, rtCmd)
 		return m, cmd
 	case stopwatch.TickMsg:
-		var p float32
-		if m.correctPos == 0 {
-			p = 0
-		} else {
-			p = float32(m.correctPos) / float32(len(m.raceWordsCharSlice))
-		}
 		rp := RaceProgress{
 			Fingerprint:        m.fingerprint,
 			RacerId:            m.racerId,
-			PercentageComplete: p,
+			PercentageComplete: raceProgressPercentage(m),
 		}
 		var raceCompletionPercentage []byte
 		raceCompletionPercentage, m.data.err = encodeRaceProgress(rp)
@@ -220,6 +221,18 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.raceTicker = &raceTicker
 		cmd = tea.Batch(cmd, rtCmd)
 		return m, cmd
+	case raceTimeUpMsg:
+		if m.activeView == activeViewRace && msg.raceStartTime == m.raceStartTime {
+			return endRace(m, cmd)
+		}
+		return m, cmd
+	case raceCountdownMsg:
+		return handleRaceCountdown(m, msg)
+	case raceTimedOutMsg:
+		if m.activeView == activeViewRace && msg.raceStartTime == m.raceStartTime {
+			return forfeitRace(m, fmt.Sprintf("the race ran out of time after %d seconds", int(m.settings.raceTimeout.Seconds())))
+		}
+		return m, cmd
 	case timer.TimeoutMsg:
 	case timer.StartStopMsg:
 		m.raceStartCountDown, cmd = m.raceStartCountDown.Update(msg)
@@ -236,53 +249,21 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return m, cmd
 	case spinner.TickMsg:
-		select {
-		case md := <-m.loadingFinished:
-			m.resetSpinner()
-			m.loading = false
-			m.data = md
-			if m.data.err != nil {
-				return m, cmd
-			}
-			switch m.activeView {
-			case activeViewWelcome, activeViewRaceFinished:
-				m.activeView = activeViewRace
-				m.raceWordsCharSlice = strings.Split(m.data.raceWords, "")
-				m.raceStartTime = time.Now().UnixMilli()
-				m.correctPos = 0
-				m.incorrectPos = 0
-				var swCmd tea.Cmd
-				if m.raceTicker == nil {
-					newWatch := stopwatch.New()
-					m.raceTicker = &newWatch
-					swCmd = m.raceTicker.Init()
-				} else {
-					swCmd = m.raceTicker.Start()
-				}
-				cmd = tea.Batch(cmd, swCmd)
-				m.racerProgressBars = make([]progress.Model, maxPlayersPerRace)
-				for i := int8(0); i < m.data.racerCount; i++ {
-					m.racerProgressBars[i] = progress.New(progress.WithSolidFill(playerColors[i]))
-					if m.fingerprint == m.data.allRacerProgress[i].Fingerprint {
-						m.racerId = i
-					}
-				}
-			}
-			return m, cmd
-		default:
-			m.spinner, cmd = m.spinner.Update(msg)
+		// the spinner only keeps ticking while waiting on a lobby
+		if !m.loading {
 			return m, cmd
 		}
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	case raceRegisteredMsg:
+		return handleRaceRegistered(m, msg)
+	case raceStartedMsg:
+		return handleRaceStarted(m, msg)
+	case registrationFailedMsg:
+		return handleRegistrationFailed(m, msg)
 	case tea.WindowSizeMsg:
 		m.termWidth = msg.Width
 		m.termHeight = msg.Height
-	default:
-		// one use case so far for unexpected messages is holding down shift and pressing space bar.
-		// I want this just to represent a space bar push so I am handling it as such.
-		var keyTypedCmd tea.Cmd
-		m, keyTypedCmd = evaluateTypedKeyMatch(m, cmd, " ")
-		cmd = tea.Batch(cmd, keyTypedCmd)
-		return m, cmd
 	}
 
 	return m, cmd
@@ -299,7 +280,6 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	// #####
 	// nice to have
 	// #####
-	// should eject inactive users
 	// Need to have a timer going so we can display words per min at the end of the race.
 	// should display as many other players in the race as possible. Maybe even use a viewport for the text area (3 lines high) so there is more room for players and I don't have to worry about screen space should there be too much text on the screen at one time.
 	// can use progress bars to represent other players. The current player should always been green so they don't lose track who they are but other players can be random colors other than green.
@@ -1,16 +1,123 @@
 package main
 
-import "testing"
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
 
 func Test_calculateWordsPerMin(t *testing.T) {
 	t.Run("happy path", func(t *testing.T) {
 		expect := 116
 		startTimeMilli := 1735257725433
 		endTimeMilli := 1735257756436
-		wordsTyped := int8(60)
+		wordsTyped := 60
 		got := calculateWordsPerMin(int64(startTimeMilli), int64(endTimeMilli), wordsTyped)
 		if got != expect {
 			t.Errorf("error, expected %d but got %d", expect, got)
 		}
 	})
 }
+
+func Test_pickSentencesForLength(t *testing.T) {
+	candidates := []sentenceCandidate{
+		{id: 1, charCount: 50},
+		{id: 2, charCount: 50},
+		{id: 3, charCount: 50},
+		{id: 4, charCount: 50},
+	}
+	t.Run("stops once the target is reached", func(t *testing.T) {
+		expected := 3
+		got := pickSentencesForLength(candidates, 120)
+		if len(got) != expected {
+			t.Errorf("error, expected %d sentences but got %d", expected, len(got))
+		}
+	})
+	t.Run("uses everything when the target can't be reached", func(t *testing.T) {
+		expected := len(candidates)
+		got := pickSentencesForLength(candidates, 1000)
+		if len(got) != expected {
+			t.Errorf("error, expected %d sentences but got %d", expected, len(got))
+		}
+	})
+}
+
+func Test_formatCodeBlock(t *testing.T) {
+	chars := strings.Split("if x {\n\treturn\n}", "")
+	t.Run("newlines and tabs are kept", func(t *testing.T) {
+		expected := "if x {\n    return\n}"
+		got := formatCodeBlock(chars, 0, 0, nil)
+		if got != expected {
+			t.Errorf("error, expected %q but got %q", expected, got)
+		}
+	})
+	t.Run("incorrect whitespace is made visible", func(t *testing.T) {
+		expected := "if_x_{↵\n→   return\n}"
+		got := formatCodeBlock(chars, 2, 8, nil)
+		if got != expected {
+			t.Errorf("error, expected %q but got %q", expected, got)
+		}
+	})
+	t.Run("free flow mistakes on whitespace are made visible", func(t *testing.T) {
+		expected := "a_b↵\nc"
+		got := formatCodeBlock(strings.Split("a b\nc", ""), 4, 4, map[int]bool{1: true, 3: true})
+		if got != expected {
+			t.Errorf("error, expected %q but got %q", expected, got)
+		}
+	})
+}
+
+func Test_evaluateTypedKeyMatch_autoIndent(t *testing.T) {
+	text := "{\n\t\treturn\n}"
+	m := model{
+		raceWordsCharSlice: strings.Split(text, ""),
+		correctPos:         1,
+		incorrectPos:       1,
+	}
+	m, _ = evaluateTypedKeyMatch(m, nil, "\n")
+	expected := 4
+	if m.correctPos != expected || m.incorrectPos != expected {
+		t.Errorf("error, expected both positions to be %d but got %d and %d", expected, m.correctPos, m.incorrectPos)
+	}
+}
+
+func Test_fetchSentenceCandidates(t *testing.T) {
+	db := newTestDatabase(t)
+	// the three easiest make up the easy tier, the rest only fill the other tiers
+	for id, difficulty := range []float64{1, 1, 1, 5, 5, 5, 9, 9, 9} {
+		mustExec(t, db, `INSERT INTO sentence (id, text, normalized_text, kind, difficulty, char_count) VALUES (?, ?, ?, 'sentence', ?, 10)`, id+1, fmt.Sprintf("sentence %d", id+1), fmt.Sprintf("sentence %d", id+1), difficulty)
+	}
+	// alice has seen 1 and 2, bob has seen 2
+	mustExec(t, db, `INSERT INTO sentence_served (ssh_finger_print, sentence_id, last_served_at) VALUES ('alice', 1, 0), ('alice', 2, 0), ('bob', 2, 0)`)
+	options := raceOptions{Mode: raceModeSentences, Difficulty: raceDifficultyEasy}
+	lobby := []string{"alice", "bob"}
+
+	order := func() []int64 {
+		t.Helper()
+		candidates, err := fetchSentenceCandidates(sentenceKindSentence, options, lobby)
+		if err != nil {
+			t.Fatalf("error, unexpected error: %v", err)
+		}
+		ids := make([]int64, len(candidates))
+		for i, c := range candidates {
+			ids[i] = c.id
+		}
+		return ids
+	}
+	got := order()
+	if len(got) != 3 || got[0] != 3 || got[1] != 1 || got[2] != 2 {
+		t.Fatalf("error, expected the one nobody has seen first and the one both have seen last [3 1 2] but got %v", got)
+	}
+
+	err := recordSentencesServed([]sentenceCandidate{{id: 3}}, lobby)
+	if err != nil {
+		t.Fatalf("error, unexpected error: %v", err)
+	}
+	got = order()
+	if got[0] != 1 {
+		t.Errorf("error, expected sentence 1 to be the least seen by the lobby once 3 was served but got %v", got)
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM sentence_served WHERE sentence_id = 3`); n != 2 {
+		t.Errorf("error, expected sentence 3 to be recorded as seen by both racers but found %d", n)
+	}
+}
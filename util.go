@@ -7,7 +7,6 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"math/rand"
 	"strings"
 	"time"
 
@@ -15,49 +14,168 @@ import (
 	"github.com/nats-io/nats.go"
 )
 
-func fetchRaceWords() (string, int8, error) {
+// raceText what racers in a race will be typing
+type raceText struct {
+	text      string
+	wordCount int
+	// attribution only set when the text is a quote
+	attribution string
+	// seed, drillChunks and wordList are only set for drills, they let racers extend the text of timed races
+	seed        int64
+	drillChunks int
+	wordList    []string
+}
+
+// fetchRaceText builds the text for a race out of whatever the mode the racers picked calls for
+func fetchRaceText(options raceOptions, racerFingerprints []string) (raceText, error) {
+	switch options.Mode {
+	case raceModeCode:
+		snippet := pickCodeSnippet(codeSnippets, options.Length.targetCharCount())
+		return raceText{
+			text:      snippet.text,
+			wordCount: countWords(snippet.text),
+		}, nil
+	case raceModeQuote:
+		return fetchRaceQuote(options, racerFingerprints)
+	case raceModeWords, raceModeCustom, raceModeNumbers, raceModeSymbols, raceModeAdaptive:
+		return buildDrillRaceText(options, racerFingerprints)
+	default:
+		return fetchRaceWords(options, racerFingerprints)
+	}
+}
+
+// buildDrillRaceText custom word lists and weak keys belong to the only racer in the lobby, see lobbyKey
+func buildDrillRaceText(options raceOptions, racerFingerprints []string) (raceText, error) {
+	var customWords []string
+	if options.Mode == raceModeCustom && len(racerFingerprints) > 0 {
+		var err error
+		customWords, err = fetchCustomWordList(racerFingerprints[0])
+		if err != nil {
+			return raceText{}, fmt.Errorf("error, when fetchCustomWordList() for buildDrillRaceText(). Error: %v", err)
+		}
+	}
+	if options.Mode == raceModeAdaptive && len(racerFingerprints) > 0 {
+		keyStats, err := fetchKeyStats(racerFingerprints[0])
+		if err != nil {
+			return raceText{}, fmt.Errorf("error, when fetchKeyStats() for buildDrillRaceText(). Error: %v", err)
+		}
+		customWords = buildAdaptiveWordList(commonEnglishWords, keyStats)
+	}
+	targetCharCount := options.Length.targetCharCount()
+	if options.timed() {
+		targetCharCount = timedRacePaceCharCount(options.TimeLimit)
+	}
+	seed := time.Now().UnixNano()
+	text, chunks := generateDrillText(options.Mode, drillWordList(options.Mode, customWords), seed, targetCharCount)
+	return raceText{
+		text:        text,
+		wordCount:   countWords(text),
+		seed:        seed,
+		drillChunks: chunks,
+		wordList:    customWords,
+	}, nil
+}
+
+// raceSentenceCandidates how many sentences are considered when filling a race to its target length
+const raceSentenceCandidates = 30
+
+type sentenceCandidate struct {
+	id        int64
+	text      string
+	wordCount int
+	charCount int
+	author    string
+	work      string
+	// seenCount how many times the registered racers have been served this sentence between them
+	seenCount int
+}
+
+// fetchRaceWords picks sentences from the difficulty tier the racers chose that they have collectively seen the least,
+// falling back on the pool wide serve count and then chance to break ties. Sentences are added until the
+// target length for the race is reached.
+func fetchRaceWords(options raceOptions, racerFingerprints []string) (raceText, error) {
 	totalSentences, err := fetchNumberOfGeneratedSentences()
 	if err != nil {
-		return "", 0, fmt.Errorf("error, when fetchNumberOfGeneratedSentences() for fetchRaceWords(). Error: %v", err)
+		return raceText{}, fmt.Errorf("error, when fetchNumberOfGeneratedSentences() for fetchRaceWords(). Error: %v", err)
 	}
-	if totalSentences <= sentencesPerTypingTest {
-		return "", 0, fmt.Errorf("error, more sentences need to generate, please wait.")
+	if totalSentences <= runtimeSettings().sentencesPerTypingTest {
+		return raceText{}, fmt.Errorf("error, more sentences need to generate, please wait.")
 	}
-	randomSentences := make([]any, sentencesPerTypingTest)
-	i := 0
-	for {
-		randomSentence := rand.Intn(totalSentences) + 1
-		duplicateFound := false
-		for _, r := range randomSentences {
-			if r == randomSentence {
-				duplicateFound = true
-				break
-			}
-		}
-		if duplicateFound {
-			continue
-		}
-		randomSentences[i] = randomSentence
-		i++
-		if i >= sentencesPerTypingTest {
-			break
-		}
+	candidates, err := fetchSentenceCandidates(sentenceKindSentence, options, racerFingerprints)
+	if err != nil {
+		return raceText{}, fmt.Errorf("error, when fetchSentenceCandidates() for fetchRaceWords(). Error: %v", err)
 	}
 
-	placeholders := make([]string, sentencesPerTypingTest)
-	for i := 0; i < sentencesPerTypingTest; i++ {
-		placeholders[i] = "?"
+	picked := pickSentencesForLength(candidates, options.Length.targetCharCount())
+	err = recordSentencesServed(picked, racerFingerprints)
+	if err != nil {
+		return raceText{}, fmt.Errorf("error, when recordSentencesServed() for fetchRaceWords(). Error: %v", err)
+	}
+	var queryResults []string
+	wordCount := 0
+	for _, p := range picked {
+		queryResults = append(queryResults, p.text)
+		wordCount += p.wordCount
 	}
+	builder := strings.Builder{}
+	builder.WriteString(strings.Join(queryResults, ". "))
+	builder.WriteRune('.')
+	return raceText{
+		text:      builder.String(),
+		wordCount: wordCount,
+	}, nil
+}
 
-	theQuery := fmt.Sprintf(
-		`SELECT text
-	FROM sentence
-	WHERE id IN (%s)`,
-		strings.Join(placeholders, ","),
-	)
+// fetchRaceQuote a quote race is a single quote, the closest in length to the target out of the quotes the racers have seen the least
+func fetchRaceQuote(options raceOptions, racerFingerprints []string) (raceText, error) {
+	candidates, err := fetchSentenceCandidates(sentenceKindQuote, options, racerFingerprints)
+	if err != nil {
+		return raceText{}, fmt.Errorf("error, when fetchSentenceCandidates() for fetchRaceQuote(). Error: %v", err)
+	}
+	if len(candidates) == 0 {
+		return raceText{}, errors.New("error, there are no quotes to race")
+	}
+	picked := pickQuoteForLength(candidates, options.Length.targetCharCount())
+	err = recordSentencesServed([]sentenceCandidate{picked}, racerFingerprints)
+	if err != nil {
+		return raceText{}, fmt.Errorf("error, when recordSentencesServed() for fetchRaceQuote(). Error: %v", err)
+	}
+	return raceText{
+		text:        picked.text,
+		wordCount:   picked.wordCount,
+		attribution: formatAttribution(picked.author, picked.work),
+	}, nil
+}
+
+// fetchSentenceCandidates sentences of the given kind from the difficulty tier the racers chose, least seen by the racers first.
+// Difficulty tiers are worked out per kind so quotes don't get compared against generated sentences.
+func fetchSentenceCandidates(kind string, options raceOptions, racerFingerprints []string) ([]sentenceCandidate, error) {
+	args := make([]any, 0, len(racerFingerprints)+3)
+	args = append(args, kind)
+	for _, f := range racerFingerprints {
+		args = append(args, f)
+	}
+	args = append(args, options.Difficulty.tier(), raceSentenceCandidates)
 	rows, err := theClients.Database.Conn.Query(
-		theQuery,
-		randomSentences...,
+		fmt.Sprintf(
+			`WITH ranked AS (
+		SELECT id, text, word_count, char_count, author, work, times_served,
+			NTILE(3) OVER (ORDER BY difficulty) AS tier
+		FROM sentence
+		WHERE kind = ?
+	)
+	SELECT r.id, r.text, r.word_count, r.char_count, r.author, r.work, COUNT(ss.sentence_id)
+	FROM ranked r
+	LEFT JOIN sentence_served ss
+		ON ss.sentence_id = r.id
+		AND ss.ssh_finger_print IN (%s)
+	WHERE r.tier = ?
+	GROUP BY r.id
+	ORDER BY COUNT(ss.sentence_id) ASC, r.times_served ASC, RANDOM()
+	LIMIT ?`,
+			placeholderList(len(racerFingerprints)),
+		),
+		args...,
 	)
 
 	defer func(rows *sql.Rows) {
@@ -71,51 +189,231 @@ func fetchRaceWords() (string, int8, error) {
 		}
 	}(rows)
 	if err != nil {
-		return "", 0, fmt.Errorf("error, when attempting to retrieve records. Error: %v", err)
+		return nil, fmt.Errorf("error, when attempting to retrieve records. Error: %v", err)
 	}
 
-	queryResults := make([]string, sentencesPerTypingTest)
-	i = 0
+	var candidates []sentenceCandidate
 	for rows.Next() {
-		var theQueryResult string
+		var c sentenceCandidate
 		err = rows.Scan(
-			&theQueryResult,
+			&c.id,
+			&c.text,
+			&c.wordCount,
+			&c.charCount,
+			&c.author,
+			&c.work,
+			&c.seenCount,
 		)
 		if err != nil {
-			return "", 0, fmt.Errorf("error, when scanning database rows. Error: %v", err)
+			return nil, fmt.Errorf("error, when scanning database rows. Error: %v", err)
 		}
-		queryResults[i] = theQueryResult
-		i++
+		candidates = append(candidates, c)
 	}
 	err = rows.Err()
 	if err != nil {
-		return "", 0, fmt.Errorf("error, when iterating through database rows. Error: %v", err)
+		return nil, fmt.Errorf("error, when iterating through database rows. Error: %v", err)
 	}
-	builder := strings.Builder{}
-	builder.WriteString(strings.Join(queryResults, ". "))
-	builder.WriteRune('.')
-	text := builder.String()
-	wordCount := len(strings.Split(text, " ")) // todo consider saving the word count in the DB to speed up game start times
-	return text, int8(wordCount), nil
+	return candidates, nil
+}
+
+func recordSentencesServed(picked []sentenceCandidate, racerFingerprints []string) error {
+	sentenceIds := make([]any, len(picked))
+	for i, p := range picked {
+		sentenceIds[i] = p.id
+	}
+	err := markSentencesServed(sentenceIds)
+	if err != nil {
+		return fmt.Errorf("error, when markSentencesServed() for recordSentencesServed(). Error: %v", err)
+	}
+	err = recordSentencesServedToRacers(racerFingerprints, sentenceIds)
+	if err != nil {
+		return fmt.Errorf("error, when recordSentencesServedToRacers() for recordSentencesServed(). Error: %v", err)
+	}
+	return nil
+}
+
+// pickQuoteForLength out of the least seen candidates the one closest to the target length, candidates must not be empty
+func pickQuoteForLength(candidates []sentenceCandidate, targetCharCount int) sentenceCandidate {
+	best := candidates[0]
+	for _, c := range candidates[1:] {
+		if c.seenCount > best.seenCount {
+			continue
+		}
+		if c.seenCount < best.seenCount || distance(c.charCount, targetCharCount) < distance(best.charCount, targetCharCount) {
+			best = c
+		}
+	}
+	return best
+}
+
+// pickSentencesForLength takes candidates in order until the joined text would be at least targetCharCount long
+func pickSentencesForLength(candidates []sentenceCandidate, targetCharCount int) []sentenceCandidate {
+	var picked []sentenceCandidate
+	charCount := 0
+	for _, c := range candidates {
+		if charCount >= targetCharCount {
+			break
+		}
+		picked = append(picked, c)
+		charCount += c.charCount + 2 // joined with ". "
+	}
+	return picked
+}
+
+func markSentencesServed(sentenceIds []any) error {
+	if len(sentenceIds) == 0 {
+		return nil
+	}
+	_, err := theClients.Database.Conn.Exec(
+		fmt.Sprintf(
+			`UPDATE sentence
+SET times_served = times_served + 1
+WHERE id IN (%s)`,
+			placeholderList(len(sentenceIds)),
+		),
+		sentenceIds...,
+	)
+	if err != nil {
+		return fmt.Errorf("error, when executing sql statement for markSentencesServed(). Error: %v", err)
+	}
+	return nil
+}
+
+func recordSentencesServedToRacers(racerFingerprints []string, sentenceIds []any) error {
+	if len(racerFingerprints) == 0 || len(sentenceIds) == 0 {
+		return nil
+	}
+	now := time.Now().Unix()
+	var inserts []string
+	var args []any
+	for _, f := range racerFingerprints {
+		for _, id := range sentenceIds {
+			inserts = append(inserts, "(?, ?, ?)")
+			args = append(args, f, id, now)
+		}
+	}
+	_, err := theClients.Database.Conn.Exec(
+		fmt.Sprintf(
+			`INSERT INTO sentence_served (ssh_finger_print, sentence_id, last_served_at)
+VALUES %s
+ON CONFLICT (ssh_finger_print, sentence_id) DO UPDATE
+SET served_count = served_count + 1,
+	last_served_at = excluded.last_served_at`,
+			strings.Join(inserts, ","),
+		),
+		args...,
+	)
+	if err != nil {
+		return fmt.Errorf("error, when executing sql statement for recordSentencesServedToRacers(). Error: %v", err)
+	}
+	return nil
+}
+
+// placeholderList produces "?,?,?" for an IN clause of the given size
+func placeholderList(size int) string {
+	placeholders := make([]string, size)
+	for i := range placeholders {
+		placeholders[i] = "?"
+	}
+	return strings.Join(placeholders, ",")
 }
 
+// mistakeToggle marks where typed text switches between correct and mistaken in free flow, zero width like the unit separator
+const mistakeToggle = "\u200C"
+
 func formatWordBlock(
 	raceWordsCharSlice []string,
 	correctPos int,
 	incorrectPos int,
+	mistakes map[int]bool,
+	width int,
 ) string {
 	unitSeperator := "\u200B" // this zero width space char doesn't appear to conflict or get counted in word wrap length functions
-	raceWordsCharSlice = insert(raceWordsCharSlice, correctPos, unitSeperator)
+	typed := withMistakeToggles(raceWordsCharSlice[:correctPos], mistakes)
+	marked := make([]string, 0, len(typed)+len(raceWordsCharSlice)-correctPos+2)
+	marked = append(marked, typed...)
+	marked = append(marked, unitSeperator)
+	raceWordsCharSlice = append(marked, raceWordsCharSlice[correctPos:]...)
 	if correctPos != incorrectPos {
-		raceWordsCharSlice = insert(raceWordsCharSlice, incorrectPos+1, unitSeperator)
+		raceWordsCharSlice = insert(raceWordsCharSlice, len(typed)+1+incorrectPos-correctPos, unitSeperator)
 	}
 	str := strings.Join(raceWordsCharSlice, "")
-	str = textBaseStyle.Render(str)
+	style := textBaseStyle.Width(width)
+	str = style.Render(str)
 	str = applyTextColors(
 		str,
 		unitSeperator,
 	)
-	return textBaseStyle.Render(str)
+	return style.Render(str)
+}
+
+// formatCodeBlock unlike formatWordBlock the text isn't wrapped, newlines and indentation are part of what is being typed
+// so they are kept as is and made visible when they are typed incorrectly or under the cursor
+func formatCodeBlock(
+	raceWordsCharSlice []string,
+	correctPos int,
+	incorrectPos int,
+	mistakes map[int]bool,
+) string {
+	b := strings.Builder{}
+	start := 0
+	for i := 1; i <= correctPos; i++ {
+		if i == correctPos || mistakes[i] != mistakes[start] {
+			if mistakes[start] {
+				b.WriteString(renderLines(displayCode(raceWordsCharSlice[start:i], true), incorrectStyle.Render))
+			} else {
+				b.WriteString(renderLines(displayCode(raceWordsCharSlice[start:i], false), correctStyle.Render))
+			}
+			start = i
+		}
+	}
+	b.WriteString(renderLines(displayCode(raceWordsCharSlice[correctPos:incorrectPos], true), incorrectStyle.Render))
+	if incorrectPos < len(raceWordsCharSlice) {
+		cursorChar := raceWordsCharSlice[incorrectPos]
+		switch cursorChar {
+		case "\n":
+			b.WriteString(cursorStyle.Render("↵"))
+			b.WriteString("\n")
+		case "\t":
+			b.WriteString(cursorStyle.Render(" "))
+			b.WriteString("   ")
+		default:
+			b.WriteString(cursorStyle.Render(cursorChar))
+		}
+		b.WriteString(renderLines(displayCode(raceWordsCharSlice[incorrectPos+1:], false), regularStyle.Render))
+	}
+	return b.String()
+}
+
+// displayCode tabs are shown as four spaces, whitespace typed incorrectly is swapped for a visible stand in
+func displayCode(chars []string, incorrect bool) string {
+	b := strings.Builder{}
+	for _, c := range chars {
+		switch {
+		case c == "\t" && incorrect:
+			b.WriteString("→   ")
+		case c == "\t":
+			b.WriteString("    ")
+		case c == "\n" && incorrect:
+			b.WriteString("↵\n")
+		case c == " " && incorrect:
+			b.WriteString("_")
+		default:
+			b.WriteString(c)
+		}
+	}
+	return b.String()
+}
+
+// renderLines styles each line on its own, otherwise lipgloss pads every line out to the width of the longest one
+func renderLines(text string, style func(...string) string) string {
+	lines := strings.Split(text, "\n")
+	for i, l := range lines {
+		if l != "" {
+			lines[i] = style(l)
+		}
+	}
+	return strings.Join(lines, "\n")
 }
 
 func applyTextColors(text string, unitSeparator string) string {
@@ -125,7 +423,14 @@ func applyTextColors(text string, unitSeparator string) string {
 	for i, p := range parts {
 		switch i {
 		case 0:
-			b.WriteString(renderAndTrim(p, false, correctStyle.Render))
+			// every other stretch of typed text is a mistake left behind in free flow
+			for j, stretch := range strings.Split(p, mistakeToggle) {
+				if j%2 == 0 {
+					b.WriteString(renderAndTrim(stretch, false, correctStyle.Render))
+				} else {
+					b.WriteString(renderAndTrim(strings.ReplaceAll(stretch, " ", "_"), false, incorrectStyle.Render))
+				}
+			}
 		case 1:
 			if len(parts) == 3 {
 				p = strings.ReplaceAll(p, " ", "_")
@@ -156,6 +461,23 @@ func renderAndTrim(text string, cursor bool, style func(...string) string) strin
 	return strings.TrimRight(b.String(), cutset)
 }
 
+// withMistakeToggles puts a mistakeToggle everywhere the typed text switches between correct and mistaken
+func withMistakeToggles(typed []string, mistakes map[int]bool) []string {
+	if len(mistakes) == 0 {
+		return typed
+	}
+	result := make([]string, 0, len(typed)+2*len(mistakes))
+	inMistake := false
+	for i, c := range typed {
+		if mistakes[i] != inMistake {
+			result = append(result, mistakeToggle)
+			inMistake = !inMistake
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
 func insert(slice []string, index int, value string) []string {
 	if index < 0 || index > len(slice) {
 		panic("index out of range")
@@ -168,7 +490,7 @@ func insert(slice []string, index int, value string) []string {
 }
 
 func calculateWordsPerMin(startTimeMillis int64, endTimeMillis int64,
-	wordsTyped int8) int {
+	wordsTyped int) int {
 	// Calculate the time difference in milliseconds
 	timeDifferenceMillis := endTimeMillis - startTimeMillis
 
@@ -185,19 +507,34 @@ func calculateWordsPerMin(startTimeMillis int64, endTimeMillis int64,
 }
 
 func evaluateTypedKeyMatch(m model, cmd tea.Cmd, keyMsg string) (model, tea.Cmd) {
+	m = recordKeystroke(m, m.raceWordsCharSlice[m.correctPos], keyMsg, time.Now())
 	if keyMsg == m.raceWordsCharSlice[m.correctPos] {
 		m.correctPos++
-		m.incorrectPos = m.correctPos // stay in sync
-		if m.correctPos >= len(m.raceWordsCharSlice) {
-			return endRace(m, cmd)
+		if keyMsg == "\n" {
+			// auto-indent, the indentation at the start of the next line is typed for the player
+			for m.correctPos < len(m.raceWordsCharSlice) && isIndentation(m.raceWordsCharSlice[m.correctPos]) {
+				m.correctPos++
+			}
 		}
 	} else {
-		i := m.incorrectPos
-		for i > 0 && m.data.raceWords[i-1] != ' ' {
-			i--
+		switch m.preferences.errorMode {
+		case errorModeStop:
+			return m, cmd
+		case errorModeFreeFlow:
+			if m.mistakes == nil {
+				m.mistakes = make(map[int]bool)
+			}
+			m.mistakes[m.correctPos] = true
+			m.correctPos++
+		default:
+			m.correctPos = errorRunStart(m, m.incorrectPos)
+			m.incorrectPos++
+			return m, cmd
 		}
-		m.correctPos = i
-		m.incorrectPos++
+	}
+	m.incorrectPos = m.correctPos // stay in sync
+	if m.data.options.timed() {
+		m = extendTimedRaceText(m)
 	}
 	return m, cmd
 }
@@ -253,6 +590,15 @@ WHERE ssh_finger_print = ?`,
 	return result, nil
 }
 
+// RegRequest sent by a racer that wants into a lobby for the given options
+type RegRequest struct {
+	Fingerprint string      `json:"fingerprint"`
+	Username    string      `json:"username,omitempty"`
+	Options     raceOptions `json:"options"`
+	// Leave takes the racer back out of the lobby they registered in, as long as its race hasn't started
+	Leave bool `json:"leave,omitempty"`
+}
+
 type RegResponse struct {
 	RaceId        string `json:"raceId"`
 	RaceStartTime int64  `json:"raceStartTime"`
@@ -260,18 +606,30 @@ type RegResponse struct {
 
 type RaceRegistration struct {
 	RaceWords       string         `json:"raceWords"`
-	WordCount       int8           `json:"wordCount"`
+	WordCount       int            `json:"wordCount"`
+	Attribution     string         `json:"attribution"`
+	Seed            int64          `json:"seed"`
+	DrillChunks     int            `json:"drillChunks"`
+	WordList        []string       `json:"wordList"`
+	Options         raceOptions    `json:"options"`
 	RaceId          string         `json:"raceId"`
 	RacerId         int8           `json:"racerId"`
 	AllRaceProgress []RaceProgress `json:"allRaceProgress"`
 	RacerCount      int8           `json:"racerCount"`
 	RaceStartTime   int64          `json:"raceStartTime"`
+	// GoTime unix millis, when typing starts for every racer. Set once the lobby closes so there is time to count down.
+	GoTime int64 `json:"goTime"`
+	// Error set instead of the race text when the race couldn't be set up, shown to the racers as is
+	Error string `json:"error,omitempty"`
 }
 
 type RaceProgress struct {
 	RacerId            int8    `json:"racerId"`
 	Fingerprint        string  `json:"fingerprint"`
+	Username           string  `json:"username,omitempty"`
 	PercentageComplete float32 `json:"percentageComplete"`
+	// DidNotFinish the racer left the race, their progress stays where it was
+	DidNotFinish bool `json:"didNotFinish,omitempty"`
 }
 
 // todo the below encodings are being made in JSON only for convience I want to get away from
@@ -366,6 +724,7 @@ func monitorRaceProgression(
 	raceId string,
 	allRacerProgressChan chan *nats.Msg,
 	raceCancel context.CancelFunc,
+	raceTimeout time.Duration,
 ) {
 	sub, err := raceNatsConnection.ChanSubscribe(raceId, allRacerProgressChan)
 	if err != nil {
@@ -375,7 +734,7 @@ func monitorRaceProgression(
 	}
 
 	select {
-	case <-time.After(time.Duration(raceTimeoutInSeconds) * time.Second):
+	case <-time.After(raceTimeout):
 		raceCancel()
 	case <-raceCtx.Done():
 	}
@@ -400,30 +759,101 @@ func processRacerProgressMsgs(messages chan *nats.Msg, progress []RaceProgress)
 			if err != nil {
 				return nil, fmt.Errorf("error, when decodeRaceProgress() for processRacerProgressMsgs(). Error: %v", err)
 			}
-			progress[p.RacerId] = p
+			if p.RacerId < 0 || int(p.RacerId) >= len(progress) {
+				continue
+			}
+			// who is in which slot comes from registration, only the progress comes from the racers
+			progress[p.RacerId].PercentageComplete = p.PercentageComplete
+			progress[p.RacerId].DidNotFinish = p.DidNotFinish
 		default:
 			return progress, nil
 		}
 	}
 }
 
+// raceProgressPercentage timed races have no end to measure against so they are measured against the pace text length instead
+func raceProgressPercentage(m model) float32 {
+	if m.correctPos == 0 {
+		return 0
+	}
+	total := len(m.raceWordsCharSlice)
+	if m.data.options.timed() {
+		total = timedRacePaceCharCount(m.data.options.TimeLimit)
+	}
+	return min(1, float32(m.correctPos)/float32(total))
+}
+
 func endRace(m model, cmd tea.Cmd) (model, tea.Cmd) {
-	m.wordsPerMin = calculateWordsPerMin(
-		m.raceStartTime,
-		time.Now().UnixMilli(),
-		m.data.wordCount,
-	)
+	result := currentRaceResult(m, false, time.Now())
+	m.wordsPerMin = result.wordsPerMin
+	m.accuracy = result.accuracy
 	m.activeView = activeViewRaceFinished
 	cmd1 := m.raceTicker.Stop()
 	cmd2 := m.raceTicker.Reset()
 	cmd = tea.Batch(cmd, cmd1, cmd2)
-	go func() {
-		err := incrementRaceCompletionCount(m.fingerprint)
-		if err != nil {
-			HandleUnexpectedError(nil, fmt.Errorf("error, when incrementRaceCompletionCount() for evaluateTypedKeyMatch(). Error: %v", err))
-			// can continue if this error happens because its not the end of the world, but still needs to be reported
-		}
-	}()
+	if recordsResults(m) {
+		go func() {
+			err := incrementRaceCompletionCount(m.fingerprint)
+			if err != nil {
+				HandleUnexpectedError(nil, fmt.Errorf("error, when incrementRaceCompletionCount() for evaluateTypedKeyMatch(). Error: %v", err))
+				// can continue if this error happens because its not the end of the world, but still needs to be reported
+			}
+		}()
+		go func(keyStats map[keyStatKey]*keyStat) {
+			err := persistKeyStats(m.fingerprint, keyStats)
+			if err != nil {
+				HandleUnexpectedError(nil, fmt.Errorf("error, when persistKeyStats() for endRace(). Error: %v", err))
+			}
+		}(m.keyStats)
+		go func() {
+			err := recordRaceResult(m.fingerprint, result)
+			if err != nil {
+				HandleUnexpectedError(nil, fmt.Errorf("error, when recordRaceResult() for endRace(). Error: %v", err))
+			}
+		}()
+	}
+	m.keyStats = nil
+	m.replayEvents = nil
+	m.raceCancel()
+	return m, cmd
+}
+
+// forfeitRace takes the player out of the race, it is recorded as not finished and the other racers are told the same
+func forfeitRace(m model, reason string) (model, tea.Cmd) {
+	result := currentRaceResult(m, true, time.Now())
+	rp := RaceProgress{
+		Fingerprint:        m.fingerprint,
+		RacerId:            m.racerId,
+		PercentageComplete: raceProgressPercentage(m),
+		DidNotFinish:       true,
+	}
+	data, err := encodeRaceProgress(rp)
+	if err == nil {
+		err = m.natsConnection.Publish(m.data.raceId, data)
+	}
+	if err != nil {
+		// the player is leaving either way, the others will just see them stop moving
+		HandleUnexpectedError(nil, fmt.Errorf("error, when publishing did not finish for forfeitRace(). Error: %v", err))
+	}
+	if recordsResults(m) {
+		go func() {
+			err := recordRaceResult(m.fingerprint, result)
+			if err != nil {
+				HandleUnexpectedError(nil, fmt.Errorf("error, when recordRaceResult() for forfeitRace(). Error: %v", err))
+			}
+		}()
+	}
+	m.activeView = activeViewRaceFinished
+	m.dnfReason = reason
+	m.wordsPerMin = result.wordsPerMin
+	m.accuracy = result.accuracy
+	var cmd tea.Cmd
+	// there is no stopwatch yet when leaving during the countdown of the first race
+	if m.raceTicker != nil {
+		cmd = tea.Batch(m.raceTicker.Stop(), m.raceTicker.Reset())
+	}
+	m.keyStats = nil
+	m.replayEvents = nil
 	m.raceCancel()
 	return m, cmd
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 )
@@ -34,7 +35,7 @@ func (m model) View() string {
 
 (PRESS ENTER TO START)
 
-
+` + renderRaceOptions(m.raceOptions, m.selectedOptionRow) + `
 
  .----------------.  .----------------.  .----------------.  .----------------.   
 | .--------------. || .--------------. || .--------------. || .--------------. |  
@@ -49,30 +50,76 @@ func (m model) View() string {
  '----------------'  '----------------'  '----------------'  '----------------' `
 		}
 	case activeViewRace:
-		wordBlock := formatWordBlock(
-			m.raceWordsCharSlice,
-			m.correctPos,
-			m.incorrectPos,
-		)
+		var wordBlock string
+		if m.data.options.Mode == raceModeCode {
+			wordBlock = formatCodeBlock(
+				m.raceWordsCharSlice,
+				m.correctPos,
+				m.incorrectPos,
+				m.mistakes,
+			)
+		} else {
+			wordBlock = formatWordBlock(
+				m.raceWordsCharSlice,
+				m.correctPos,
+				m.incorrectPos,
+				m.mistakes,
+				m.settings.typingTestDesiredWidth,
+			)
+		}
 		racerViews := strings.Builder{}
 		for i := int8(0); i < m.data.racerCount; i++ {
 			racerViews.WriteString("\n\n")
-			var playerTitle string
+			playerTitle := racerName(m.data.allRacerProgress[i])
 			if m.data.allRacerProgress[i].Fingerprint == m.fingerprint {
-				playerTitle = fmt.Sprintf("player %d (you)", i)
-			} else {
-				playerTitle = fmt.Sprintf("player %d", i)
+				playerTitle += " (you)"
+			}
+			if m.data.allRacerProgress[i].DidNotFinish {
+				playerTitle += " (dnf)"
 			}
 			racerViews.WriteString(fmt.Sprintf("%s: ", playerTitle))
 			racerViews.WriteString(m.racerProgressBars[i].View())
 			racerViews.WriteString("\n")
 		}
-		content = fmt.Sprintf("%s\n%s", wordBlock, racerViews.String())
+		var timeLeft string
+		if label := countdownLabel(m, time.Now()); label != "" {
+			timeLeft = fmt.Sprintf("%s\n\n", label)
+		} else if m.raceTicker != nil {
+			remaining := m.settings.raceTimeout - m.raceTicker.Elapsed()
+			if m.data.options.timed() {
+				remaining = min(remaining, m.data.options.TimeLimit.duration()-m.raceTicker.Elapsed())
+			}
+			timeLeft = fmt.Sprintf("time left: %ds\n\n", max(0, int(remaining.Seconds())))
+		}
+		content = fmt.Sprintf("%s%s\n%s\n(ESC TO LEAVE THE RACE)", timeLeft, wordBlock, racerViews.String())
+	case activeViewCustomWords:
+		content = getCustomWordsEditorView(m)
+	case activeViewProfile:
+		content = getProfileView(m)
+	case activeViewAccount:
+		content = getAccountView(m)
+	case activeViewReplays:
+		content = getReplaysView(m)
+	case activeViewReplay:
+		content = getReplayView(m)
 	case activeViewRaceFinished:
 		if m.loading {
 			content = getRaceLoadingView(m)
 		} else {
-			content = fmt.Sprintf("Words Per Min: %d\n\n(PRESS ENTER TO PLAY AGAIN)", m.wordsPerMin)
+			var attribution string
+			if m.data.attribution != "" {
+				attribution = fmt.Sprintf("%s\n\n", m.data.attribution)
+			}
+			result := fmt.Sprintf("Words Per Min: %d\n\nAccuracy: %.0f%%", m.wordsPerMin, m.accuracy*100)
+			if m.dnfReason != "" {
+				result = fmt.Sprintf("DID NOT FINISH, %s", m.dnfReason)
+			}
+			content = fmt.Sprintf(
+				"%s%s\n\n(PRESS ENTER TO PLAY AGAIN)\n\n%s",
+				attribution,
+				result,
+				renderRaceOptions(m.raceOptions, m.selectedOptionRow),
+			)
 		}
 	}
 	return m.renderer.Place(
@@ -84,9 +131,21 @@ func (m model) View() string {
 	)
 }
 
+// countdownLabel 3, 2, 1 before the race starts and GO for the first second of it, empty after that
+func countdownLabel(m model, now time.Time) string {
+	untilGo := time.UnixMilli(m.raceStartTime).Sub(now)
+	switch {
+	case untilGo > 0:
+		return fmt.Sprintf("%d", int((untilGo+time.Second-1)/time.Second))
+	case untilGo > -time.Second:
+		return "GO!"
+	}
+	return ""
+}
+
 func getRaceLoadingView(m model) string {
 	s := m.spinner.View()
-	return fmt.Sprintf("%s waiting for other players %s %s", s, m.raceStartCountDown.View(), s)
+	return fmt.Sprintf("%s waiting for other players %s %s\n\n(ESC TO LEAVE THE LOBBY)", s, m.raceStartCountDown.View(), s)
 }
 
 func getErrorStyle(errMsg string) string {